@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/DARKestMODE/movify/internal/data"
 	"github.com/DARKestMODE/movify/internal/validator"
 	"github.com/julienschmidt/httprouter"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]interface{}
@@ -117,6 +119,50 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+// readMovieQuery reads the movie filters shared by listMoviesHandler and
+// exportMoviesHandler.
+func (app *application) readMovieQuery(qs url.Values, v *validator.Validator) data.MovieQuery {
+	return data.MovieQuery{
+		Title:         app.readString(qs, "title", ""),
+		Genres:        app.readCSV(qs, "genres", []string{}),
+		ReleaseFrom:   app.readString(qs, "release_from", ""),
+		ReleaseTo:     app.readString(qs, "release_to", ""),
+		Year:          app.readInt(qs, "year", 0, v),
+		RuntimeMin:    app.readInt(qs, "runtime_min", 0, v),
+		RuntimeMax:    app.readInt(qs, "runtime_max", 0, v),
+		PopularityMin: app.readFloat(qs, "popularity_min", 0, v),
+		PopularityMax: app.readFloat(qs, "popularity_max", 0, v),
+	}
+}
+
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+	return &b
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
@@ -130,3 +176,32 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// periodically runs fn every interval for the lifetime of the process.
+func (app *application) periodically(interval time.Duration, fn func() error) {
+	go func() {
+		for {
+			err := fn()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// validatePasswordNotBreached rejects passwords found in the local breached password
+// corpus, when one is configured.
+func (app *application) validatePasswordNotBreached(v *validator.Validator, password string) error {
+	if app.pwned == nil {
+		return nil
+	}
+
+	count, err := app.pwned.Count(password)
+	if err != nil {
+		return err
+	}
+
+	v.Check(count == 0, "password", "has appeared in a data breach, please choose another one")
+	return nil
+}
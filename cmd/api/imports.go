@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/tmdb"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (app *application) importTMDBMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs         []int64 `json:"ids"`
+		ListID      string  `json:"list_id"`
+		ReleaseFrom string  `json:"release_from"`
+		ReleaseTo   string  `json:"release_to"`
+		Limit       int     `json:"limit"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Limit == 0 {
+		input.Limit = 20
+	}
+
+	v := validator.New()
+
+	sources := 0
+	for _, given := range []bool{len(input.IDs) > 0, input.ListID != "", input.ReleaseFrom != "" || input.ReleaseTo != ""} {
+		if given {
+			sources++
+		}
+	}
+	v.Check(sources == 1, "source", "must be exactly one of ids, list_id or release_from and release_to")
+	v.Check(len(input.IDs) <= 100, "ids", "must not contain more than 100 ids")
+	v.Check(input.Limit >= 1 && input.Limit <= 100, "limit", "must be between 1 and 100")
+
+	var from, to time.Time
+	if input.ReleaseFrom != "" || input.ReleaseTo != "" {
+		from, err = time.Parse("2006-01-02", input.ReleaseFrom)
+		v.Check(err == nil, "release_from", "must be a date formatted as YYYY-MM-DD")
+		to, err = time.Parse("2006-01-02", input.ReleaseTo)
+		v.Check(err == nil, "release_to", "must be a date formatted as YYYY-MM-DD")
+		v.Check(!to.Before(from), "release_to", "must not be before release_from")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ids := input.IDs
+	switch {
+	case input.ListID != "":
+		ids, err = app.tmdb.ListIDs(r.Context(), input.ListID, input.Limit)
+	case !from.IsZero():
+		ids, err = app.tmdb.DiscoverIDs(r.Context(), from, to, input.Limit)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, tmdb.ErrNotFound):
+			v.AddError("list_id", "does not exist on TMDB")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	job := &data.ImportJob{Source: "tmdb", CreatedBy: &userID}
+
+	err = app.models.ImportJobs.Insert(job)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// fetching the movies is rate limited and would outlast the request, so the
+	// client polls the job for the report instead. The goroutine finishes its own
+	// copy of the job, as the response below is still encoding this one.
+	running := *job
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tmdbImportTimeout)
+		defer cancel()
+
+		importer := &tmdb.Importer{Client: app.tmdb, Movies: app.models.Movies}
+		report, err := importer.Import(ctx, ids)
+
+		err = app.models.ImportJobs.Finish(&running, report, err)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"import_job_id": strconv.FormatInt(running.ID, 10)})
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/imports/%d", job.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"job": job}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	job, err := app.models.ImportJobs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+const (
+	tmdbImportTimeout    = 10 * time.Minute
+	movieImportMaxBytes  = 32 << 20
+	movieImportBatchSize = 500
+)
+
+type movieImportRow struct {
+	Row     int               `json:"row"`
+	IdTMDB  int64             `json:"id_tmdb,omitempty"`
+	Status  string            `json:"status"`
+	MovieID int64             `json:"movie_id,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// movieImportFailure is the row at which an import stopped.
+type movieImportFailure struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type movieImportReport struct {
+	Created  int                 `json:"created"`
+	Updated  int                 `json:"updated"`
+	Rejected int                 `json:"rejected"`
+	Failed   int                 `json:"failed"`
+	Failure  *movieImportFailure `json:"failure,omitempty"`
+	Rows     []movieImportRow    `json:"rows"`
+}
+
+// movieReader yields the movies of an import one row at a time. Problems with a
+// single row are returned as field errors, while an error means the stream as a
+// whole can't be read any further. row is the number by which the report refers
+// to the row last read.
+type movieReader interface {
+	next() (*data.Movie, map[string]string, error)
+	row() int
+}
+
+// importMoviesHandler upserts movies from a CSV (text/csv) or JSON Lines
+// (application/x-ndjson) body. CSV needs a header row naming the columns, which
+// are the fields of createMovieHandler, with genres separated by "|".
+//
+// Movies are committed in batches. When the body turns out to be malformed, or a
+// batch can't be written, the rows before the failing one stay imported and the
+// report says where the import stopped, so that the client can resume from there.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, movieImportMaxBytes)
+
+	var reader movieReader
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		reader, err = newCSVMovieReader(r.Body)
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		reader = newNDJSONMovieReader(r.Body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := &movieImportReport{Rows: []movieImportRow{}}
+	var batch []*data.Movie
+	var batchRows []int
+
+	fail := func(status int, row int, message string) {
+		report.Failure = &movieImportFailure{Row: row, Error: message}
+
+		err := app.writeJSON(w, status, envelope{"error": message, "report": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+
+	// flush writes the batch, or on failure marks its rows as failed and returns
+	// the number of the row that couldn't be written
+	flush := func() (int, error) {
+		if len(batch) == 0 {
+			return 0, nil
+		}
+
+		inserted, err := app.models.Movies.UpsertBatch(batch)
+		if err != nil {
+			failed := 0
+			var batchErr *data.BatchError
+			if errors.As(err, &batchErr) {
+				failed = batchErr.Index
+			}
+
+			for _, i := range batchRows {
+				report.Rows[i].Status = "failed"
+				report.Failed++
+			}
+			return report.Rows[batchRows[failed]].Row, err
+		}
+
+		for i, mv := range batch {
+			row := &report.Rows[batchRows[i]]
+			row.MovieID = mv.Id
+			if inserted[i] {
+				row.Status = "created"
+				report.Created++
+			} else {
+				row.Status = "updated"
+				report.Updated++
+			}
+		}
+
+		batch, batchRows = batch[:0], batchRows[:0]
+		return 0, nil
+	}
+
+	for {
+		mv, rowErrors, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		n := reader.row()
+		if err != nil {
+			// the rows read so far are complete, so they are imported before the
+			// malformed one is reported
+			if row, err := flush(); err != nil {
+				app.logError(r, err)
+				fail(http.StatusInternalServerError, row, "the movie could not be saved")
+				return
+			}
+
+			fail(http.StatusBadRequest, n, fmt.Sprintf("row %d: %s", n, err))
+			return
+		}
+
+		v := validator.New()
+		for key, message := range rowErrors {
+			v.AddError(key, message)
+		}
+		if mv != nil {
+			data.ValidateMovie(v, mv)
+		}
+
+		row := movieImportRow{Row: n}
+		if mv != nil {
+			row.IdTMDB = mv.IdTMDB
+		}
+		if !v.Valid() {
+			row.Status = "rejected"
+			row.Errors = v.Errors
+			report.Rejected++
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+
+		report.Rows = append(report.Rows, row)
+		batch = append(batch, mv)
+		batchRows = append(batchRows, len(report.Rows)-1)
+
+		if len(batch) == movieImportBatchSize {
+			if row, err := flush(); err != nil {
+				app.logError(r, err)
+				fail(http.StatusInternalServerError, row, "the movie could not be saved")
+				return
+			}
+		}
+	}
+
+	if row, err := flush(); err != nil {
+		app.logError(r, err)
+		fail(http.StatusInternalServerError, row, "the movie could not be saved")
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+var movieImportColumns = []string{"id_tmdb", "title", "overview", "release_date", "runtime", "genres", "popularity", "poster_path"}
+
+type csvMovieReader struct {
+	csv     *csv.Reader
+	columns []string
+	rows    int
+}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		// id and created_at appear in exports and are ignored, so that an export
+		// can be imported again as is
+		if !validator.In(header[i], movieImportColumns...) && !validator.In(header[i], "id", "created_at") {
+			return nil, fmt.Errorf("header contains unknown column %q", column)
+		}
+	}
+	if !validator.Unique(header) {
+		return nil, errors.New("header must not contain duplicate columns")
+	}
+
+	return &csvMovieReader{csv: cr, columns: header}, nil
+}
+
+// row counts the records after the header.
+func (cr *csvMovieReader) row() int {
+	return cr.rows
+}
+
+func (cr *csvMovieReader) next() (*data.Movie, map[string]string, error) {
+	cr.rows++
+	record, err := cr.csv.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(parseError.Err, csv.ErrFieldCount) {
+			return nil, map[string]string{"row": fmt.Sprintf("must have %d fields", len(cr.columns))}, nil
+		}
+		return nil, nil, err
+	}
+
+	mv := &data.Movie{}
+	rowErrors := make(map[string]string)
+
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+
+		switch cr.columns[i] {
+		case "id_tmdb":
+			mv.IdTMDB, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				rowErrors["id_tmdb"] = "must be an integer"
+			}
+		case "title":
+			mv.Title = value
+		case "overview":
+			mv.Overview = value
+		case "release_date":
+			mv.ReleaseDate = value
+		case "runtime":
+			runtime, err := strconv.ParseInt(value, 10, 16)
+			if err != nil {
+				rowErrors["runtime"] = "must be an integer"
+			}
+			mv.Runtime = int16(runtime)
+		case "genres":
+			mv.Genres = []string{}
+			for _, genre := range strings.Split(value, "|") {
+				if genre = strings.TrimSpace(genre); genre != "" {
+					mv.Genres = append(mv.Genres, genre)
+				}
+			}
+		case "popularity":
+			popularity, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				rowErrors["popularity"] = "must be a number"
+			}
+			mv.Popularity = float32(popularity)
+		case "poster_path":
+			mv.PosterPath = value
+		}
+	}
+
+	return mv, rowErrors, nil
+}
+
+type ndjsonMovieReader struct {
+	r     *bufio.Reader
+	lines int
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	return &ndjsonMovieReader{r: bufio.NewReader(r)}
+}
+
+// row is the line number, counting the blank lines which next skips.
+func (nr *ndjsonMovieReader) row() int {
+	return nr.lines
+}
+
+func (nr *ndjsonMovieReader) next() (*data.Movie, map[string]string, error) {
+	var line []byte
+	for len(bytes.TrimSpace(line)) == 0 {
+		var err error
+		line, err = nr.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil, nil, io.EOF
+		}
+		nr.lines++
+		if err == io.EOF && len(bytes.TrimSpace(line)) == 0 {
+			return nil, nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+	}
+
+	var input struct {
+		IdTMDB      int64    `json:"id_tmdb"`
+		Title       string   `json:"title"`
+		Overview    string   `json:"overview"`
+		ReleaseDate string   `json:"release_date"`
+		Runtime     int16    `json:"runtime"`
+		Genres      []string `json:"genres"`
+		Popularity  float32  `json:"popularity"`
+		PosterPath  string   `json:"poster_path"`
+
+		// as with CSV, these appear in exports and are ignored
+		ID        json.RawMessage `json:"id"`
+		CreatedAt json.RawMessage `json:"created_at"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&input)
+	if err != nil {
+		return nil, map[string]string{"row": "must be a single valid JSON object: " + err.Error()}, nil
+	}
+	// as in readJSON, anything after the object makes the row invalid
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		return nil, map[string]string{"row": "must be a single valid JSON object"}, nil
+	}
+
+	mv := &data.Movie{
+		IdTMDB:      input.IdTMDB,
+		Title:       input.Title,
+		Overview:    input.Overview,
+		ReleaseDate: input.ReleaseDate,
+		Runtime:     input.Runtime,
+		Popularity:  input.Popularity,
+		PosterPath:  input.PosterPath,
+		Genres:      input.Genres,
+	}
+	return mv, nil, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"github.com/DARKestMODE/movify/internal/data"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type movieReaderRow struct {
+	row       int
+	movie     *data.Movie
+	rowErrors []string
+}
+
+// readMovies drains reader, returning the rows up to the end of the body or the
+// first error.
+func readMovies(reader movieReader) ([]movieReaderRow, error) {
+	var rows []movieReaderRow
+	for {
+		mv, rowErrors, err := reader.next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+
+		row := movieReaderRow{row: reader.row(), movie: mv}
+		for key := range rowErrors {
+			row.rowErrors = append(row.rowErrors, key)
+		}
+		sort.Strings(row.rowErrors)
+		rows = append(rows, row)
+	}
+}
+
+func TestCSVMovieReader(t *testing.T) {
+	matrix := &data.Movie{
+		IdTMDB:      603,
+		Title:       "The Matrix",
+		Overview:    "A hacker learns the truth",
+		ReleaseDate: "1999-03-30",
+		Runtime:     136,
+		Genres:      []string{"action", "sci-fi"},
+		Popularity:  82.5,
+		PosterPath:  "/matrix.jpg",
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     bool
+		wantRows    []movieReaderRow
+		wantReadErr bool
+	}{
+		{
+			name: "every column",
+			body: "id_tmdb,title,overview,release_date,runtime,genres,popularity,poster_path\n" +
+				`603,The Matrix,"A hacker learns the truth",1999-03-30,136,action| sci-fi |,82.5,/matrix.jpg` + "\n",
+			wantRows: []movieReaderRow{{movie: matrix}},
+		},
+		{
+			name:     "export columns ignored",
+			body:     "ID, Id_TMDB ,title,created_at\n1,603,The Matrix,2024-01-01T00:00:00Z\n",
+			wantRows: []movieReaderRow{{movie: &data.Movie{IdTMDB: 603, Title: "The Matrix"}}},
+		},
+		{
+			name: "invalid numbers",
+			body: "id_tmdb,runtime,popularity\nabc,long,high\n",
+			wantRows: []movieReaderRow{{
+				movie:     &data.Movie{},
+				rowErrors: []string{"id_tmdb", "popularity", "runtime"},
+			}},
+		},
+		{
+			name: "wrong field count",
+			body: "id_tmdb,title\n603\n604,Other\n",
+			wantRows: []movieReaderRow{
+				{row: 1, rowErrors: []string{"row"}},
+				{row: 2, movie: &data.Movie{IdTMDB: 604, Title: "Other"}},
+			},
+		},
+		{
+			name:        "unterminated quote",
+			body:        "id_tmdb,title\n603,\"The Matrix\n",
+			wantReadErr: true,
+		},
+		{name: "empty body", body: "", wantErr: true},
+		{name: "unknown column", body: "id_tmdb,rating\n", wantErr: true},
+		{name: "duplicate column", body: "title,Title\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newCSVMovieReader(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			rows, err := readMovies(reader)
+			if (err != nil) != tt.wantReadErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantReadErr)
+			}
+			if !tt.wantReadErr {
+				assertMovieRows(t, rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestNDJSONMovieReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantRows []movieReaderRow
+	}{
+		{
+			name: "rows",
+			body: `{"id_tmdb":603,"title":"The Matrix","runtime":136,"genres":["action"]}` + "\n" +
+				`{"id_tmdb":604,"title":"The Matrix Reloaded"}`,
+			wantRows: []movieReaderRow{
+				{movie: &data.Movie{IdTMDB: 603, Title: "The Matrix", Runtime: 136, Genres: []string{"action"}}},
+				{movie: &data.Movie{IdTMDB: 604, Title: "The Matrix Reloaded"}},
+			},
+		},
+		{
+			name: "export fields ignored",
+			body: `{"id":1,"id_tmdb":603,"title":"The Matrix","created_at":"2024-01-01T00:00:00Z"}`,
+			wantRows: []movieReaderRow{
+				{movie: &data.Movie{IdTMDB: 603, Title: "The Matrix"}},
+			},
+		},
+		{
+			name: "blank lines skipped but counted",
+			body: "\n  \n" + `{"id_tmdb":603}` + "\r\n\n" + `{"id_tmdb":604}`,
+			wantRows: []movieReaderRow{
+				{row: 3, movie: &data.Movie{IdTMDB: 603}},
+				{row: 5, movie: &data.Movie{IdTMDB: 604}},
+			},
+		},
+		{
+			name: "trailing data",
+			body: `{"id_tmdb":603} {"id_tmdb":604}` + "\n" + `{"id_tmdb":605}]` + "\n" + `{"id_tmdb":606}` + "\n",
+			wantRows: []movieReaderRow{
+				{row: 1, rowErrors: []string{"row"}},
+				{row: 2, rowErrors: []string{"row"}},
+				{row: 3, movie: &data.Movie{IdTMDB: 606}},
+			},
+		},
+		{
+			name: "malformed rows",
+			body: `{"id_tmdb":603,"rating":5}` + "\n" + `{"id_tmdb":` + "\n" + `[1]` + "\n" + `{"id_tmdb":604}`,
+			wantRows: []movieReaderRow{
+				{rowErrors: []string{"row"}},
+				{rowErrors: []string{"row"}},
+				{rowErrors: []string{"row"}},
+				{movie: &data.Movie{IdTMDB: 604}},
+			},
+		},
+		{name: "empty body", body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readMovies(newNDJSONMovieReader(strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertMovieRows(t, rows, tt.wantRows)
+		})
+	}
+}
+
+func assertMovieRows(t *testing.T, got, want []movieReaderRow) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows; want %d", len(got), len(want))
+	}
+	for i := range got {
+		if want[i].row != 0 && got[i].row != want[i].row {
+			t.Errorf("row %d: got row number %d; want %d", i+1, got[i].row, want[i].row)
+		}
+		if !reflect.DeepEqual(got[i].rowErrors, want[i].rowErrors) {
+			t.Errorf("row %d: got errors %v; want %v", i+1, got[i].rowErrors, want[i].rowErrors)
+		}
+		if want[i].movie != nil && !reflect.DeepEqual(got[i].movie, want[i].movie) {
+			t.Errorf("row %d: got movie %+v; want %+v", i+1, got[i].movie, want[i].movie)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app *application) createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email       string     `json:"email"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	invite := &data.Invite{
+		Email:       input.Email,
+		Permissions: input.Permissions,
+		Expiry:      time.Now().Add(7 * 24 * time.Hour),
+	}
+	if input.Expiry != nil {
+		invite.Expiry = *input.Expiry
+	}
+
+	v := validator.New()
+	if data.ValidateInvite(v, invite, known); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invite, err = app.models.Invites.New(invite.Email, invite.Permissions, user.ID, invite.Expiry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		d := map[string]interface{}{
+			"email":      invite.Email,
+			"inviteCode": invite.Plaintext,
+			"expiry":     invite.Expiry.UTC().Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(invite.Email, "user_invite.tmpl", d)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/invites/%d", invite.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invite": invite}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	invites, err := app.models.Invites.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invites": invites}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteInviteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Invites.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invite successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/jwt"
+	"github.com/tomasen/realip"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) newSignedSessionToken(r *http.Request, user *data.User, family []byte) (*data.Token, error) {
+	var err error
+	if family == nil {
+		family, err = data.GenerateFamily()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	jti := make([]byte, 16)
+	_, err = rand.Read(jti)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := &jwt.Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		ID:          hex.EncodeToString(jti),
+		IssuedAt:    float64(now.UnixNano()/1e3) / 1e6,
+		ExpiresAt:   now.Add(app.config.jwt.ttl).Unix(),
+		Session:     hex.EncodeToString(family),
+		Activated:   user.Activated,
+		Permissions: permissions,
+	}
+
+	signed, err := app.keyring.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// the session row is only kept for listing and revocation, authentication
+	// never reads it back
+	hash := sha256.Sum256([]byte(signed))
+	token := &data.Token{
+		Plaintext: signed,
+		Hash:      hash[:],
+		UserID:    user.ID,
+		Expiry:    time.Unix(claims.ExpiresAt, 0),
+		Scope:     data.ScopeAuthentication,
+		Family:    family,
+		UserAgent: r.UserAgent(),
+		ClientIP:  realip.FromRequest(r),
+	}
+
+	err = app.models.Tokens.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (app *application) verifySignedToken(token string) (*jwt.Claims, int64, error) {
+	claims, err := app.keyring.Verify(token, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if app.denylist.Revoked(claims, userID) {
+		return nil, 0, jwt.ErrInvalidToken
+	}
+	return claims, userID, nil
+}
+
+func (app *application) revokeSignedSession(userID int64, family []byte) error {
+	if !app.config.jwt.enabled || family == nil {
+		return nil
+	}
+
+	entry := &data.DenylistEntry{
+		Family: family,
+		UserID: userID,
+		Expiry: time.Now().Add(app.config.jwt.ttl),
+	}
+	err := app.models.Denylist.Insert(entry)
+	if err != nil {
+		return err
+	}
+
+	app.denylist.AddSession(hex.EncodeToString(family), entry.Expiry)
+	return nil
+}
+
+func (app *application) revokeAllSignedSessions(userID int64) error {
+	if !app.config.jwt.enabled {
+		return nil
+	}
+
+	entry := &data.DenylistEntry{
+		UserID: userID,
+		Expiry: time.Now().Add(app.config.jwt.ttl),
+	}
+	err := app.models.Denylist.Insert(entry)
+	if err != nil {
+		return err
+	}
+
+	app.denylist.AddUser(userID, entry.RevokedAt)
+	return nil
+}
+
+// syncDenylist picks up revocations made by other instances and prunes expired
+// entries.
+func (app *application) syncDenylist() error {
+	entries, err := app.models.Denylist.GetAllActive()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Family == nil {
+			app.denylist.AddUser(entry.UserID, entry.RevokedAt)
+		} else {
+			app.denylist.AddSession(hex.EncodeToString(entry.Family), entry.Expiry)
+		}
+	}
+
+	app.denylist.Prune(time.Now(), app.config.jwt.ttl)
+
+	return app.models.Denylist.DeleteExpired()
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"github.com/DARKestMODE/movify/internal/data"
 	"github.com/DARKestMODE/movify/internal/jsonlog"
+	"github.com/DARKestMODE/movify/internal/jwt"
 	"github.com/DARKestMODE/movify/internal/mailer"
+	"github.com/DARKestMODE/movify/internal/oidc"
+	"github.com/DARKestMODE/movify/internal/pwned"
+	"github.com/DARKestMODE/movify/internal/tmdb"
 	_ "github.com/lib/pq"
 	"os"
 	"runtime"
@@ -20,7 +26,7 @@ import (
 
 var (
 	buildTime string
-	version string
+	version   string
 )
 
 type config struct {
@@ -47,14 +53,56 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	jwt struct {
+		enabled   bool
+		algorithm string
+		keys      []string
+		ttl       time.Duration
+	}
+	totp struct {
+		issuer        string
+		encryptionKey []byte
+	}
+	users struct {
+		deletionGracePeriod time.Duration
+		inviteOnly          bool
+	}
+	permissions struct {
+		registration     []string
+		activation       []string
+		protectMovieRead bool
+		cacheTTL         time.Duration
+	}
+	oidc struct {
+		providers []oidc.Config
+	}
+	argon2 struct {
+		memory      uint
+		iterations  uint
+		parallelism uint
+	}
+	passwords struct {
+		minEntropy  float64
+		breachedDir string
+	}
+	tmdb struct {
+		baseURL string
+		apiKey  string
+		rps     float64
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	keyring  *jwt.Keyring
+	denylist *jwt.Denylist
+	oidc     map[string]*oidc.Provider
+	pwned    *pwned.List
+	tmdb     *tmdb.Client
+	wg       sync.WaitGroup
 }
 
 func main() {
@@ -84,6 +132,62 @@ func main() {
 		return nil
 	})
 
+	flag.BoolVar(&cfg.jwt.enabled, "jwt-enabled", false, "Issue signed stateless access tokens")
+	flag.StringVar(&cfg.jwt.algorithm, "jwt-algorithm", jwt.AlgorithmHS256, "Access token signing algorithm (HS256|EdDSA)")
+	// signed tokens carry the user's activation and permissions as of when they
+	// were issued; deactivating, disabling or revoking permissions from a user
+	// denylists their tokens, anything else shows once they are refreshed
+	flag.DurationVar(&cfg.jwt.ttl, "jwt-ttl", 15*time.Minute, "Access token lifetime")
+	flag.Func("jwt-keys", "Access token keys as kid:base64 (space separated, the first one signs)", func(val string) error {
+		cfg.jwt.keys = strings.Fields(val)
+		return nil
+	})
+
+	flag.StringVar(&cfg.totp.issuer, "totp-issuer", "Movify", "Issuer shown in authenticator apps")
+	flag.Func("totp-encryption-key", "Base64 encoded 32 byte key encrypting TOTP secrets", func(val string) error {
+		key, err := base64.StdEncoding.DecodeString(val)
+		if err != nil || len(key) != 32 {
+			return errors.New("must be 32 bytes encoded as base64")
+		}
+		cfg.totp.encryptionKey = key
+		return nil
+	})
+
+	flag.DurationVar(&cfg.users.deletionGracePeriod, "user-deletion-grace-period", 30*24*time.Hour, "Time before a deleted account is purged")
+	flag.BoolVar(&cfg.users.inviteOnly, "user-invite-only", false, "Require an invite code to register")
+
+	cfg.permissions.activation = []string{"movies:read"}
+	flag.Func("permissions-registration", "Permissions granted on registration (space separated)", func(val string) error {
+		cfg.permissions.registration = strings.Fields(val)
+		return nil
+	})
+	flag.Func("permissions-activation", "Permissions granted on activation (space separated, default \"movies:read\")", func(val string) error {
+		cfg.permissions.activation = strings.Fields(val)
+		return nil
+	})
+	flag.DurationVar(&cfg.permissions.cacheTTL, "permissions-cache-ttl", time.Minute, "How long resolved user permissions are cached (0 disables)")
+	flag.BoolVar(&cfg.permissions.protectMovieRead, "permissions-protect-movie-read", false, "Require the movies:read permission to read movies")
+
+	flag.UintVar(&cfg.argon2.memory, "argon2-memory", 64*1024, "Argon2id password hashing memory in KiB")
+	flag.UintVar(&cfg.argon2.iterations, "argon2-iterations", 3, "Argon2id password hashing iterations")
+	flag.UintVar(&cfg.argon2.parallelism, "argon2-parallelism", 2, "Argon2id password hashing parallelism")
+
+	flag.Float64Var(&cfg.passwords.minEntropy, "password-min-entropy", 40, "Minimum estimated entropy of new passwords in bits")
+	flag.StringVar(&cfg.passwords.breachedDir, "password-breached-dir", "", "Directory of SHA-1 prefix files listing breached passwords (disabled if empty)")
+
+	flag.StringVar(&cfg.tmdb.baseURL, "tmdb-base-url", tmdb.DefaultBaseURL, "TMDB compatible API base URL")
+	flag.StringVar(&cfg.tmdb.apiKey, "tmdb-api-key", os.Getenv("TMDB_API_KEY"), "TMDB API key or read access token")
+	flag.Float64Var(&cfg.tmdb.rps, "tmdb-rps", 20, "Maximum TMDB API requests per second")
+
+	flag.Func("oidc-provider", "OpenID Connect provider as name=..,issuer=..,client-id=..,client-secret=..,redirect-url=..[,auto-link=true] (repeatable)", func(val string) error {
+		provider, err := oidc.ParseConfig(val)
+		if err != nil {
+			return err
+		}
+		cfg.oidc.providers = append(cfg.oidc.providers, provider)
+		return nil
+	})
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -96,6 +200,14 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	if cfg.argon2.iterations < 1 || cfg.argon2.parallelism < 1 || cfg.argon2.parallelism > 255 || cfg.argon2.memory < 8*cfg.argon2.parallelism {
+		logger.PrintFatal(errors.New("invalid argon2 parameters"), nil)
+	}
+	data.PasswordParams.Memory = uint32(cfg.argon2.memory)
+	data.PasswordParams.Iterations = uint32(cfg.argon2.iterations)
+	data.PasswordParams.Parallelism = uint8(cfg.argon2.parallelism)
+	data.PasswordMinEntropy = cfg.passwords.minEntropy
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -113,6 +225,12 @@ func main() {
 		return db.Stats()
 	}))
 
+	permissionCache := data.NewPermissionCache(cfg.permissions.cacheTTL)
+
+	expvar.Publish("permissions_cache", expvar.Func(func() interface{} {
+		return permissionCache.Stats()
+	}))
+
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
 	}))
@@ -120,10 +238,41 @@ func main() {
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: data.NewModels(db, permissionCache),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		oidc:   make(map[string]*oidc.Provider),
+		tmdb:   tmdb.NewClient(cfg.tmdb.baseURL, cfg.tmdb.apiKey, cfg.tmdb.rps),
 	}
 
+	err = app.checkGrantedPermissions()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if cfg.passwords.breachedDir != "" {
+		app.pwned, err = pwned.Open(cfg.passwords.breachedDir)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	for _, provider := range cfg.oidc.providers {
+		app.oidc[provider.Name] = oidc.NewProvider(provider, nil)
+	}
+
+	if cfg.jwt.enabled {
+		app.keyring, err = openKeyring(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		app.denylist = jwt.NewDenylist()
+		app.periodically(30*time.Second, app.syncDenylist)
+	}
+
+	app.periodically(time.Hour, app.models.LoginAttempts.DeleteStale)
+	app.periodically(time.Hour, app.purgeDeletedUsers)
+	app.periodically(time.Minute, permissionCache.Prune)
+
 	if err = app.serve(); err != nil {
 		logger.PrintFatal(err, nil)
 	}
@@ -151,3 +300,15 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+func openKeyring(cfg config) (*jwt.Keyring, error) {
+	var keys []jwt.Key
+	for _, spec := range cfg.jwt.keys {
+		key, err := jwt.ParseKey(cfg.jwt.algorithm, spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return jwt.NewKeyring(keys...)
+}
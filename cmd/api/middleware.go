@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/sha256"
 	"errors"
 	"expvar"
 	"fmt"
@@ -78,7 +79,28 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	})
 }
 
+const sessionTouchInterval = time.Minute
+
 func (app *application) authenticate(next http.Handler) http.Handler {
+	var (
+		mu          sync.Mutex
+		lastTouched = make(map[string]time.Time)
+	)
+
+	// background, cleanup goroutine
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			mu.Lock()
+			for hash, t := range lastTouched {
+				if time.Since(t) > sessionTouchInterval {
+					delete(lastTouched, hash)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
@@ -91,31 +113,94 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 || (headerParts[0] != "Bearer" && headerParts[0] != "ApiKey") {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
 		token := headerParts[1]
+		touch := app.models.Tokens.Touch
 
-		v := validator.New()
-		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
-			return
-		}
-
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
-		if err != nil {
-			switch {
-			case errors.Is(err, data.ErrRecordNotFound):
+		var user *data.User
+		switch {
+		case headerParts[0] == "ApiKey":
+			v := validator.New()
+			if data.ValidateAPIKeyPlaintext(v, token); !v.Valid() {
 				app.invalidAuthenticationTokenResponse(w, r)
-			default:
+				return
+			}
+
+			key, keyUser, err := app.models.APIKeys.GetForKey(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			// a key never grants more than its owner currently holds
+			granted, err := app.models.Permissions.GetAllForUser(keyUser.ID)
+			if err != nil {
 				app.serverErrorResponse(w, r, err)
+				return
 			}
-			return
+
+			user = keyUser
+			touch = app.models.APIKeys.Touch
+			r = app.contextSetAPIKey(r, key)
+			r = app.contextSetPermissions(r, granted.Intersect(key.Permissions))
+		case app.config.jwt.enabled && strings.Count(token, ".") == 2:
+			claims, userID, err := app.verifySignedToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user = &data.User{ID: userID, Activated: claims.Activated}
+			r = app.contextSetPermissions(r, data.Permissions(claims.Permissions))
+		default:
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			var err error
+			user, err = app.models.Users.GetForToken(data.ScopeAuthentication, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+
+		// last_used_at is written at most once per interval for every session or key
+		hash := sha256.Sum256([]byte(token))
+		mu.Lock()
+		touched := time.Since(lastTouched[string(hash[:])]) > sessionTouchInterval
+		if touched {
+			lastTouched[string(hash[:])] = time.Now()
+		}
+		mu.Unlock()
+
+		if touched {
+			app.background(func() {
+				err := touch(hash[:], sessionTouchInterval)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			})
 		}
 
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -123,6 +208,10 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
+		if user.IsDisabled() {
+			app.disabledAccountResponse(w, r)
+			return
+		}
 		if !user.Activated {
 			app.inactiveAccountResponse(w, r)
 			return
@@ -144,13 +233,33 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	}
 }
 
+// requireUserSession rejects requests authenticated with an API key, which must
+// not be able to change the credentials of their owner.
+func (app *application) requireUserSession(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetAPIKey(r); ok {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+
+		// signed tokens carry their permissions, opaque ones are resolved per request
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 
 		if !permissions.Include(code) {
@@ -163,6 +272,15 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// requireMovieRead guards the catalogue read routes, which are public unless the
+// server is configured otherwise.
+func (app *application) requireMovieRead(next http.HandlerFunc) http.HandlerFunc {
+	if !app.config.permissions.protectMovieRead {
+		return next
+	}
+	return app.requirePermission("movies:read", next)
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/DARKestMODE/movify/internal/data"
 	"github.com/DARKestMODE/movify/internal/validator"
+	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +52,13 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	err = app.models.Movies.Insert(mv)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateTMDBID):
+			v.AddError("id_tmdb", "a movie with this TMDB id already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -60,6 +72,12 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// httprouter can't register /v1/movies/export next to /v1/movies/:id
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "export" {
+		app.exportMoviesHandler(w, r)
+		return
+	}
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
@@ -151,7 +169,13 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	err = app.models.Movies.Update(movie)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateTMDBID):
+			v.AddError("id_tmdb", "a movie with this TMDB id already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -161,6 +185,69 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// upsertMovieByTMDBIDHandler creates the movie with the TMDB id from the URL, or
+// replaces every field of the existing one.
+func (app *application) upsertMovieByTMDBIDHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	idTMDB, err := strconv.ParseInt(params.ByName("id_tmdb"), 10, 64)
+	if err != nil || idTMDB < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title       string   `json:"title"`
+		Overview    string   `json:"overview"`
+		ReleaseDate string   `json:"release_date"`
+		Runtime     int16    `json:"runtime"`
+		Genres      []string `json:"genres"`
+		Popularity  float32  `json:"popularity"`
+		PosterPath  string   `json:"poster_path"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	mv := &data.Movie{
+		IdTMDB:      idTMDB,
+		Title:       input.Title,
+		Overview:    input.Overview,
+		ReleaseDate: input.ReleaseDate,
+		Runtime:     input.Runtime,
+		Popularity:  input.Popularity,
+		PosterPath:  input.PosterPath,
+		Genres:      input.Genres,
+	}
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, mv); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	inserted, err := app.models.Movies.Upsert(mv)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+	if inserted {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/movies/%d", mv.Id))
+	}
+
+	err = app.writeJSON(w, status, envelope{"movie": mv}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -186,26 +273,25 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieQuery
 		data.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MovieQuery = app.readMovieQuery(qs, v)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	input.Filters.SortSafeList = []string{"id", "title", "release_date", "runtime", "popularity", "-id", "-title", "-release_date", "-runtime", "-popularity"}
 
+	data.ValidateMovieQuery(v, input.MovieQuery)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieQuery, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -216,3 +302,143 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+const movieExportChunkTimeout = 30 * time.Second
+
+// exportedMovie is a line of a JSON Lines export, which uses the names of the CSV
+// columns so that it can be imported again as is.
+type exportedMovie struct {
+	ID          int64     `json:"id"`
+	IdTMDB      int64     `json:"id_tmdb"`
+	Title       string    `json:"title"`
+	Overview    string    `json:"overview"`
+	ReleaseDate string    `json:"release_date"`
+	Runtime     int16     `json:"runtime"`
+	Genres      []string  `json:"genres"`
+	Popularity  float32   `json:"popularity"`
+	PosterPath  string    `json:"poster_path"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// exportMoviesHandler streams every movie matching the filters of listMoviesHandler
+// as JSON Lines, or as CSV when format=csv. The CSV columns are those accepted by
+// importMoviesHandler, plus the id and creation time. Every chunk flushed gets
+// another movieExportChunkTimeout to be written, so that a large export isn't cut
+// off by the server's WriteTimeout.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieQuery
+		Format string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.MovieQuery = app.readMovieQuery(qs, v)
+	input.Format = app.readString(qs, "format", "ndjson")
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "title", "release_date", "runtime", "popularity", "-id", "-title", "-release_date", "-runtime", "-popularity"}
+
+	data.ValidateMovieQuery(v, input.MovieQuery)
+	v.Check(validator.In(input.Format, "ndjson", "csv"), "format", "must be ndjson or csv")
+	v.Check(validator.In(input.Filters.Sort, input.Filters.SortSafeList...), "sort", "invalid sort value")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var write func(*data.Movie) error
+	var flush func() error
+
+	switch input.Format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := append(append([]string{"id"}, movieImportColumns...), "created_at")
+		write = func(mv *data.Movie) error {
+			return cw.Write([]string{
+				strconv.FormatInt(mv.Id, 10),
+				strconv.FormatInt(mv.IdTMDB, 10),
+				mv.Title,
+				mv.Overview,
+				mv.ReleaseDate,
+				strconv.Itoa(int(mv.Runtime)),
+				strings.Join(mv.Genres, "|"),
+				strconv.FormatFloat(float64(mv.Popularity), 'f', -1, 32),
+				mv.PosterPath,
+				mv.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+		cw.Write(header)
+	default:
+		enc := json.NewEncoder(w)
+		write = func(mv *data.Movie) error {
+			return enc.Encode(exportedMovie{
+				ID:          mv.Id,
+				IdTMDB:      mv.IdTMDB,
+				Title:       mv.Title,
+				Overview:    mv.Overview,
+				ReleaseDate: mv.ReleaseDate,
+				Runtime:     mv.Runtime,
+				Genres:      mv.Genres,
+				Popularity:  mv.Popularity,
+				PosterPath:  mv.PosterPath,
+				CreatedAt:   mv.CreatedAt,
+			})
+		}
+		flush = func() error { return nil }
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.ndjson"`)
+	}
+
+	n := 0
+
+	rc := http.NewResponseController(w)
+
+	err := rc.SetWriteDeadline(time.Now().Add(movieExportChunkTimeout))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Movies.Export(r.Context(), input.MovieQuery, input.Filters, func(mv *data.Movie) error {
+		err := write(mv)
+		if err != nil {
+			return err
+		}
+
+		n++
+		if n%500 == 0 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+			err = rc.Flush()
+			if err != nil {
+				return err
+			}
+			return rc.SetWriteDeadline(time.Now().Add(movieExportChunkTimeout))
+		}
+		return nil
+	})
+	if err != nil && n == 0 {
+		w.Header().Del("Content-Disposition")
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// the status line has been sent, all that can be done is to cut the
+		// response short and log why
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/oidc"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (app *application) createOIDCAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidc[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	state := &data.OIDCState{
+		Provider: provider.Name(),
+		Expiry:   time.Now().Add(10 * time.Minute),
+	}
+
+	var err error
+	for _, s := range []*string{&state.Plaintext, &state.Nonce, &state.CodeVerifier} {
+		*s, err = oidc.RandomString()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(r.Context(), state.Plaintext, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.OIDCStates.Insert(state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authorization_url": authorizationURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createOIDCAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		State string `json:"state"`
+		Code  string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.State != "", "state", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	state, err := app.models.OIDCStates.Consume(input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired state")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	provider, ok := app.oidc[state.Provider]
+	if !ok {
+		v.AddError("state", "invalid or expired state")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), input.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+			app.logger.PrintError(err, map[string]string{"provider": provider.Name()})
+			v.AddError("code", "could not be verified with the provider")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.userForIdentity(provider, identity, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// userForIdentity returns the account linked to the identity. An unlinked identity
+// gets a new account, or is linked to the account with the same email when the
+// provider is configured with auto-link, since a provider which doesn't own the
+// address could otherwise hand over the account. Either way the provider must
+// have verified the address, or anyone could claim an account before its owner
+// signs up. Problems the client can fix are reported through v.
+func (app *application) userForIdentity(provider *oidc.Provider, identity *oidc.Identity, v *validator.Validator) (*data.User, error) {
+	if !identity.EmailVerified {
+		v.AddError("email", "must be verified by the provider")
+		return nil, nil
+	}
+
+	user, err := app.models.Identities.GetUser(provider.Name(), identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if data.ValidateEmail(v, identity.Email); !v.Valid() {
+		return nil, nil
+	}
+
+	user, err = app.models.Users.GetByEmail(identity.Email)
+	switch {
+	case err == nil:
+		if !provider.AutoLink() {
+			v.AddError("email", "a user with this email address already exists")
+			return nil, nil
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		if app.config.users.inviteOnly {
+			v.AddError("email", "registration is by invitation only")
+			return nil, nil
+		}
+		user, err = app.registerOIDCUser(identity, v)
+		if err != nil || !v.Valid() {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if !user.Activated {
+		user.Activated = true
+
+		err = app.models.Users.Update(user)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.grantActivationPermissions(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = app.models.Identities.Insert(&data.Identity{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// registerOIDCUser creates an account for a new identity. It gets a random password,
+// which the user can replace through the password reset flow.
+func (app *application) registerOIDCUser(identity *oidc.Identity, v *validator.Validator) (*data.User, error) {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	user := &data.User{
+		Name:  name,
+		Email: identity.Email,
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		return nil, nil
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if len(app.config.permissions.registration) > 0 {
+		err = app.models.Permissions.AddForUser(user.ID, app.config.permissions.registration...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/DARKestMODE/movify/internal/oidc"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"testing"
+)
+
+// An unverified email must be rejected before the database is even consulted, so
+// the application here has no models to fall back on.
+func TestUserForIdentityUnverifiedEmail(t *testing.T) {
+	app := &application{}
+	v := validator.New()
+
+	user, err := app.userForIdentity(oidc.NewProvider(oidc.Config{Name: "fake"}, nil), &oidc.Identity{Subject: "subject-1", Email: "victim@example.com"}, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("got user %+v; want none", user)
+	}
+	if v.Errors["email"] == "" {
+		t.Errorf("got errors %v; want an email error", v.Errors)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"net/http"
+)
+
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserPermissions(w, r, app.models.Permissions.AddForUser)
+}
+
+func (app *application) revokeUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserPermissions(w, r, app.revokingSignedSessions(app.models.Permissions.RemoveForUser))
+}
+
+func (app *application) grantUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserRoles(w, r, app.models.Roles.AddForUser)
+}
+
+func (app *application) revokeUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserRoles(w, r, app.revokingSignedSessions(app.models.Roles.RemoveForUser))
+}
+
+// revokingSignedSessions makes a revocation apply to signed access tokens straight
+// away. They carry the permissions they were issued with, so the ones the user
+// holds are denylisted, and the next refresh issues one with what is left.
+func (app *application) revokingSignedSessions(change func(int64, ...string) error) func(int64, ...string) error {
+	return func(userID int64, values ...string) error {
+		err := change(userID, values...)
+		if err != nil {
+			return err
+		}
+		return app.revokeAllSignedSessions(userID)
+	}
+}
+
+func (app *application) changeUserPermissions(w http.ResponseWriter, r *http.Request, change func(int64, ...string) error) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePermissionCodes(v, input.Permissions, known); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = change(user.ID, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) changeUserRoles(w http.ResponseWriter, r *http.Request, change func(int64, ...string) error) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateRoleNames(v, input.Roles, known); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = change(user.ID, input.Roles...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) writeUserPermissions(w http.ResponseWriter, r *http.Request, userID int64) {
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	direct, err := app.models.Permissions.GetDirectForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"permissions":        permissions,
+		"direct_permissions": direct,
+		"roles":              roles,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// grantActivationPermissions gives a user who has just been activated, by whatever
+// means, the permissions configured for activated users.
+func (app *application) grantActivationPermissions(userID int64) error {
+	if len(app.config.permissions.activation) == 0 {
+		return nil
+	}
+	return app.models.Permissions.AddForUser(userID, app.config.permissions.activation...)
+}
+
+// checkGrantedPermissions makes sure the permissions granted on registration and
+// activation exist, as granting an unknown code silently does nothing.
+func (app *application) checkGrantedPermissions() error {
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		return err
+	}
+
+	flags := []struct {
+		name  string
+		codes []string
+	}{
+		{"permissions-registration", app.config.permissions.registration},
+		{"permissions-activation", app.config.permissions.activation},
+	}
+	for _, flag := range flags {
+		for _, code := range flag.codes {
+			if !known.Include(code) {
+				return fmt.Errorf("-%s: unknown permission %q", flag.name, code)
+			}
+		}
+	}
+	return nil
+}
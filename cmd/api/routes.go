@@ -14,16 +14,64 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requireMovieRead(app.listMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requireMovieRead(app.showMovieHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/import", app.requirePermission("movies:write", app.importMoviesHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/tmdb/:id_tmdb", app.requirePermission("movies:write", app.upsertMovieByTMDBIDHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activate", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/restore", app.restoreUserHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireUserSession(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireUserSession(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireUserSession(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireUserSession(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireUserSession(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireUserSession(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireUserSession(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireUserSession(app.deleteAPIKeyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/mfa/totp", app.requireUserSession(app.enrollTOTPHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/mfa/totp", app.requireUserSession(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/mfa/totp", app.requireUserSession(app.disableTOTPHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireUserSession(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", app.requireUserSession(app.deleteAllAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/magic-link", app.createMagicLinkAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/oidc", app.createOIDCAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/oidc/:provider/authorize", app.createOIDCAuthorizationHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/users/:id", app.requirePermission("users:admin", app.updateUserActivationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission("users:admin", app.forceUserPasswordResetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/tokens", app.requirePermission("users:admin", app.revokeUserTokensHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.showUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.revokeUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.grantUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.revokeUserRolesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invites", app.requirePermission("users:admin", app.listInvitesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invites", app.requirePermission("users:admin", app.createInviteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invites/:id", app.requirePermission("users:admin", app.deleteInviteHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/imports/tmdb", app.requirePermission("movies:admin", app.importTMDBMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/imports/:id", app.requirePermission("movies:admin", app.showImportJobHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/permissions", app.requireActivatedUser(app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/roles", app.requireActivatedUser(app.listRolesHandler))
 
 	router.Handler(http.MethodGet, "/v1/metrics", expvar.Handler())
 
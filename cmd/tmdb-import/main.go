@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/jsonlog"
+	"github.com/DARKestMODE/movify/internal/tmdb"
+	_ "github.com/lib/pq"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type config struct {
+	dsn     string
+	baseURL string
+	apiKey  string
+	rps     float64
+	ids     []int64
+	listID  string
+	from    string
+	to      string
+	limit   int
+}
+
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("MOVIFY_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.baseURL, "tmdb-base-url", tmdb.DefaultBaseURL, "TMDB compatible API base URL")
+	flag.StringVar(&cfg.apiKey, "tmdb-api-key", os.Getenv("TMDB_API_KEY"), "TMDB API key or read access token")
+	flag.Float64Var(&cfg.rps, "tmdb-rps", 20, "Maximum TMDB API requests per second")
+
+	flag.Func("ids", "TMDB movie ids to import (space separated)", func(val string) error {
+		for _, field := range strings.Fields(val) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || id < 1 {
+				return errors.New("must only contain positive integers")
+			}
+			cfg.ids = append(cfg.ids, id)
+		}
+		return nil
+	})
+	flag.StringVar(&cfg.listID, "list", "", "Import the movies on this TMDB list")
+	flag.StringVar(&cfg.from, "from", "", "Import movies released on or after this date (YYYY-MM-DD)")
+	flag.StringVar(&cfg.to, "to", "", "Import movies released on or before this date (YYYY-MM-DD)")
+	flag.IntVar(&cfg.limit, "limit", 1000, "Maximum number of movies to import from a list or date range")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stderr, jsonlog.LevelInfo)
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client := tmdb.NewClient(cfg.baseURL, cfg.apiKey, cfg.rps)
+
+	ids, err := resolveIDs(ctx, client, cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	logger.PrintInfo("importing movies", map[string]string{"count": strconv.Itoa(len(ids))})
+
+	importer := &tmdb.Importer{Client: client, Movies: data.MovieModel{DB: db}}
+
+	// a failed import still reports the movies it got through
+	report, importErr := importer.Import(ctx, ids)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(report)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if importErr != nil {
+		logger.PrintFatal(importErr, nil)
+	}
+}
+
+func resolveIDs(ctx context.Context, client *tmdb.Client, cfg config) ([]int64, error) {
+	switch {
+	case len(cfg.ids) > 0:
+		return cfg.ids, nil
+	case cfg.listID != "":
+		return client.ListIDs(ctx, cfg.listID, cfg.limit)
+	case cfg.from != "" && cfg.to != "":
+		from, err := time.Parse("2006-01-02", cfg.from)
+		if err != nil {
+			return nil, err
+		}
+		to, err := time.Parse("2006-01-02", cfg.to)
+		if err != nil {
+			return nil, err
+		}
+		return client.DiscoverIDs(ctx, from, to, cfg.limit)
+	default:
+		return nil, errors.New("one of -ids, -list or -from and -to must be provided")
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
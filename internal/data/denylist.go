@@ -0,0 +1,77 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DenylistEntry revokes a single token family, or every token of the user issued
+// before RevokedAt when Family is nil.
+type DenylistEntry struct {
+	Family    []byte
+	UserID    int64
+	RevokedAt time.Time
+	Expiry    time.Time
+}
+
+type DenylistModel struct {
+	DB *sql.DB
+}
+
+func (m DenylistModel) Insert(entry *DenylistEntry) error {
+	// stamped with the clock signed tokens are issued with rather than the
+	// database's, as the two are compared to the microsecond
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
+	}
+
+	q := `INSERT INTO token_denylist (family, user_id, revoked_at, expiry)
+		  VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, entry.Family, entry.UserID, entry.RevokedAt, entry.Expiry)
+	return err
+}
+
+func (m DenylistModel) GetAllActive() ([]*DenylistEntry, error) {
+	q := `SELECT family, user_id, revoked_at, expiry
+		  FROM token_denylist
+		  WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*DenylistEntry{}
+	for rows.Next() {
+		var entry DenylistEntry
+		err := rows.Scan(&entry.Family, &entry.UserID, &entry.RevokedAt, &entry.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (m DenylistModel) DeleteExpired() error {
+	q := `DELETE FROM token_denylist
+		  WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, time.Now())
+	return err
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity links an account to a subject at an external OpenID Connect provider.
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	q := `INSERT INTO user_identities (user_id, provider, subject, email)
+		  VALUES ($1, $2, $3, NULLIF($4, ''))
+		  ON CONFLICT (provider, subject) DO NOTHING
+		  RETURNING id, created_at`
+
+	args := []interface{}{identity.UserID, identity.Provider, identity.Subject, identity.Email}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, args...).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	q := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.disabled_at, users.version
+		  FROM users
+		  INNER JOIN user_identities ON user_identities.user_id = users.id
+		  WHERE user_identities.provider = $1
+		  AND user_identities.subject = $2
+		  AND users.deleted_at IS NULL`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DisabledAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	q := `SELECT id, provider, subject, COALESCE(email, ''), created_at
+		  FROM user_identities
+		  WHERE user_id = $1
+		  ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		identity := Identity{UserID: userID}
+		err := rows.Scan(
+			&identity.ID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// OIDCState is what has to survive the redirect to the provider and back:
+// the provider it was issued for, the nonce and the PKCE code verifier.
+type OIDCState struct {
+	Plaintext    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+type OIDCStateModel struct {
+	DB *sql.DB
+}
+
+func (m OIDCStateModel) Insert(state *OIDCState) error {
+	q := `INSERT INTO oidc_states (hash, provider, nonce, code_verifier, expiry)
+		  VALUES ($1, $2, $3, $4, $5)`
+
+	hash := sha256.Sum256([]byte(state.Plaintext))
+	args := []interface{}{hash[:], state.Provider, state.Nonce, state.CodeVerifier, state.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, args...)
+	return err
+}
+
+// Consume deletes the state so that it can only be redeemed once. Expired
+// states are removed along the way.
+func (m OIDCStateModel) Consume(plaintext string) (*OIDCState, error) {
+	q := `DELETE FROM oidc_states
+		  WHERE hash = $1 OR expiry <= $2
+		  RETURNING hash, provider, nonce, code_verifier, expiry`
+
+	hash := sha256.Sum256([]byte(plaintext))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	rows, err := m.DB.QueryContext(ctx, q, hash[:], now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found *OIDCState
+	for rows.Next() {
+		var rowHash []byte
+		state := OIDCState{Plaintext: plaintext}
+		err := rows.Scan(&rowHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		if string(rowHash) == string(hash[:]) && state.Expiry.After(now) {
+			found = &state
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, ErrRecordNotFound
+	}
+	return found, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ImportJobRunning   = "running"
+	ImportJobSucceeded = "succeeded"
+	ImportJobFailed    = "failed"
+)
+
+// ImportJob tracks an import running in the background. Report is left to the
+// importer, which stores whatever summary it produces.
+type ImportJob struct {
+	ID         int64           `json:"id"`
+	Source     string          `json:"source"`
+	Status     string          `json:"status"`
+	Report     json.RawMessage `json:"report,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedBy  *int64          `json:"created_by,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+func (m ImportJobModel) Insert(job *ImportJob) error {
+	q := `INSERT INTO import_jobs (source, status, created_by)
+		  VALUES ($1, $2, $3)
+		  RETURNING id, created_at`
+
+	job.Status = ImportJobRunning
+	args := []interface{}{job.Source, job.Status, job.CreatedBy}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, q, args...).Scan(&job.ID, &job.CreatedAt)
+}
+
+// Finish records the outcome of the job: its report, and the error when it failed.
+// A job that failed part way keeps the report of what it did until then.
+func (m ImportJobModel) Finish(job *ImportJob, result interface{}, jobErr error) error {
+	job.Status = ImportJobSucceeded
+	if jobErr != nil {
+		job.Status = ImportJobFailed
+		job.Error = jobErr.Error()
+	}
+
+	report, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if string(report) != "null" {
+		job.Report = report
+	}
+
+	q := `UPDATE import_jobs
+		  SET status = $1, report = $2, error = NULLIF($3, ''), finished_at = NOW()
+		  WHERE id = $4
+		  RETURNING finished_at`
+
+	// lib/pq would send []byte as bytea, which jsonb doesn't accept
+	var reportArg interface{}
+	if job.Report != nil {
+		reportArg = string(job.Report)
+	}
+
+	args := []interface{}{job.Status, reportArg, job.Error, job.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, q, args...).Scan(&job.FinishedAt)
+}
+
+func (m ImportJobModel) Get(id int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	q := `SELECT id, source, status, report, COALESCE(error, ''), created_by, created_at, finished_at
+		  FROM import_jobs
+		  WHERE id = $1`
+
+	var job ImportJob
+	var report []byte
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, id).Scan(
+		&job.ID,
+		&job.Source,
+		&job.Status,
+		&report,
+		&job.Error,
+		&job.CreatedBy,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	job.Report = report
+	return &job, nil
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Invite struct {
+	ID          int64          `json:"id"`
+	Plaintext   string         `json:"-"`
+	Hash        []byte         `json:"-"`
+	Email       string         `json:"email"`
+	Permissions pq.StringArray `json:"permissions"`
+	CreatedBy   *int64         `json:"created_by,omitempty"`
+	Expiry      time.Time      `json:"expiry"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UsedAt      *time.Time     `json:"used_at,omitempty"`
+}
+
+func generateInvite(email string, permissions []string, createdBy int64, expiry time.Time) (*Invite, error) {
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	invite := &Invite{
+		Email:       email,
+		Permissions: permissions,
+		CreatedBy:   &createdBy,
+		Expiry:      expiry,
+	}
+
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(invite.Plaintext))
+	invite.Hash = hash[:]
+	return invite, nil
+}
+
+func ValidateInviteCode(v *validator.Validator, code string) {
+	v.Check(code != "", "invite_code", "must be provided")
+	v.Check(len(code) == 26, "invite_code", "must be 26 bytes long")
+}
+
+func ValidateInvite(v *validator.Validator, invite *Invite, known Permissions) {
+	ValidateEmail(v, invite.Email)
+	v.Check(validator.Unique(invite.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range invite.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain known permission codes")
+	}
+	v.Check(invite.Expiry.After(time.Now()), "expiry", "must be in the future")
+}
+
+type InviteModel struct {
+	DB *sql.DB
+}
+
+func (m InviteModel) New(email string, permissions []string, createdBy int64, expiry time.Time) (*Invite, error) {
+	invite, err := generateInvite(email, permissions, createdBy, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(invite)
+	return invite, err
+}
+
+func (m InviteModel) Insert(invite *Invite) error {
+	q := `INSERT INTO invites (hash, email, permissions, created_by, expiry)
+		  VALUES ($1, $2, $3, $4, $5)
+		  RETURNING id, created_at`
+
+	args := []interface{}{invite.Hash, invite.Email, pq.Array(invite.Permissions), invite.CreatedBy, invite.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, q, args...).Scan(&invite.ID, &invite.CreatedAt)
+}
+
+func (m InviteModel) GetAll() ([]*Invite, error) {
+	q := `SELECT id, email, permissions, created_by, expiry, created_at, used_at
+		  FROM invites
+		  ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*Invite{}
+	for rows.Next() {
+		var invite Invite
+		err := rows.Scan(
+			&invite.ID,
+			&invite.Email,
+			&invite.Permissions,
+			&invite.CreatedBy,
+			&invite.Expiry,
+			&invite.CreatedAt,
+			&invite.UsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, &invite)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// GetForCode returns the unused, unexpired invite issued to email under code.
+func (m InviteModel) GetForCode(code, email string) (*Invite, error) {
+	hash := sha256.Sum256([]byte(code))
+
+	q := `SELECT id, email, permissions, created_by, expiry, created_at, used_at
+		  FROM invites
+		  WHERE hash = $1
+		  AND email = $2
+		  AND used_at IS NULL
+		  AND expiry > $3`
+
+	invite := Invite{Plaintext: code, Hash: hash[:]}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, hash[:], email, time.Now()).Scan(
+		&invite.ID,
+		&invite.Email,
+		&invite.Permissions,
+		&invite.CreatedBy,
+		&invite.Expiry,
+		&invite.CreatedAt,
+		&invite.UsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &invite, nil
+}
+
+// Redeem registers the invited user, activated, with the given permissions, and
+// marks the invite as used, all in one transaction. It fails with
+// ErrRecordNotFound when the invite expired or someone else redeemed it first, in
+// which case no account is created.
+func (m InviteModel) Redeem(invite *Invite, user *User, permissions []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := `UPDATE invites
+		  SET used_at = NOW()
+		  WHERE id = $1 AND used_at IS NULL AND expiry > NOW()
+		  RETURNING used_at`
+
+	err = tx.QueryRowContext(ctx, q, invite.ID).Scan(&invite.UsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	user.Activated = true
+
+	q = `INSERT INTO users (name, email, password_hash, activated)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at, version`
+
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	err = tx.QueryRowContext(ctx, q, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	q = `INSERT INTO users_permissions
+		 SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		 ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, q, user.ID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m InviteModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	q := `DELETE FROM invites
+		  WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+// LoginPolicy describes how failed logins for a single key are throttled. Once the
+// free attempts are used up every failure doubles the wait before the next one,
+// and reaching LockoutThreshold locks the key for LockoutDuration.
+type LoginPolicy struct {
+	FreeAttempts     int
+	MaxBackoff       time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	Window           time.Duration
+}
+
+var (
+	EmailLoginPolicy = LoginPolicy{
+		FreeAttempts:     3,
+		MaxBackoff:       5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  30 * time.Minute,
+		Window:           24 * time.Hour,
+	}
+	// addresses may be shared by many users, so they are only slowed down
+	IPLoginPolicy = LoginPolicy{
+		FreeAttempts: 20,
+		MaxBackoff:   15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+func (p LoginPolicy) wait(failures int) (time.Duration, bool) {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration, failures == p.LockoutThreshold
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+
+	backoff := time.Second
+	for i := p.FreeAttempts + 1; i < failures && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff, false
+}
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// LockedUntil returns the latest time until which any of the keys is blocked.
+func (m LoginAttemptModel) LockedUntil(keys ...string) (time.Time, error) {
+	q := `SELECT COALESCE(MAX(locked_until), 'epoch')
+		  FROM login_attempts
+		  WHERE key = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lockedUntil time.Time
+	err := m.DB.QueryRowContext(ctx, q, pq.Array(keys)).Scan(&lockedUntil)
+	return lockedUntil, err
+}
+
+// RecordFailure counts a failed login for the key and blocks it according to the
+// policy. The returned flag reports whether this failure triggered a lockout.
+func (m LoginAttemptModel) RecordFailure(key string, policy LoginPolicy) (time.Time, bool, error) {
+	q := `INSERT INTO login_attempts (key, failures, last_failure_at)
+		  VALUES ($1, 1, NOW())
+		  ON CONFLICT (key) DO UPDATE
+		  SET failures = CASE WHEN login_attempts.last_failure_at < $2 THEN 1 ELSE login_attempts.failures + 1 END,
+		      last_failure_at = NOW()
+		  RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, q, key, time.Now().Add(-policy.Window)).Scan(&failures)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	wait, locked := policy.wait(failures)
+	if wait == 0 {
+		return time.Time{}, false, nil
+	}
+
+	lockedUntil := time.Now().Add(wait)
+	_, err = m.DB.ExecContext(ctx, `UPDATE login_attempts SET locked_until = $1 WHERE key = $2`, lockedUntil, key)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return lockedUntil, locked, nil
+}
+
+func (m LoginAttemptModel) Reset(key string) error {
+	q := `DELETE FROM login_attempts
+		  WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, key)
+	return err
+}
+
+func (m LoginAttemptModel) DeleteStale() error {
+	q := `DELETE FROM login_attempts
+		  WHERE last_failure_at < $1
+		  AND (locked_until IS NULL OR locked_until < NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, time.Now().Add(-EmailLoginPolicy.Window))
+	return err
+}
@@ -11,17 +11,35 @@ var (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies        MovieModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Roles         RoleModel
+	Denylist      DenylistModel
+	APIKeys       APIKeyModel
+	MFA           MFAModel
+	LoginAttempts LoginAttemptModel
+	Identities    IdentityModel
+	OIDCStates    OIDCStateModel
+	Invites       InviteModel
+	ImportJobs    ImportJobModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, permissionCache *PermissionCache) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:        MovieModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Permissions:   PermissionModel{DB: db, Cache: permissionCache},
+		Roles:         RoleModel{DB: db, Cache: permissionCache},
+		Denylist:      DenylistModel{DB: db},
+		APIKeys:       APIKeyModel{DB: db},
+		MFA:           MFAModel{DB: db},
+		LoginAttempts: LoginAttemptModel{DB: db},
+		Identities:    IdentityModel{DB: db},
+		OIDCStates:    OIDCStateModel{DB: db},
+		Invites:       InviteModel{DB: db},
+		ImportJobs:    ImportJobModel{DB: db},
 	}
 }
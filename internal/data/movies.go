@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"github.com/DARKestMODE/movify/internal/validator"
 	"github.com/lib/pq"
+	"math"
 	"time"
 )
 
+var ErrDuplicateTMDBID = errors.New("duplicate tmdb id")
+
 type Movie struct {
 	Id          int64          `gorm:"primaryKey"`
 	IdTMDB      int64          `json:"IdTMDB"`
@@ -39,6 +42,9 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(movie.Overview != "", "overview", "must be provided")
 	v.Check(movie.ReleaseDate != "", "release date", "must be provided")
+	releaseDate, err := time.Parse("2006-01-02", movie.ReleaseDate)
+	v.Check(err == nil, "release date", "must be a date formatted as YYYY-MM-DD")
+	v.Check(err != nil || releaseDate.Year() >= 1888, "release date", "must not be before 1888")
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 	v.Check(movie.Popularity != 0, "popularity", "must be provided")
@@ -50,6 +56,73 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
 }
 
+// MovieQuery narrows down the movies returned by GetAll and Export. Zero values
+// don't filter, and dates are formatted as YYYY-MM-DD.
+type MovieQuery struct {
+	Title         string
+	Genres        []string
+	ReleaseFrom   string
+	ReleaseTo     string
+	Year          int
+	RuntimeMin    int
+	RuntimeMax    int
+	PopularityMin float64
+	PopularityMax float64
+}
+
+func ValidateMovieQuery(v *validator.Validator, q MovieQuery) {
+	var from, to time.Time
+	var err error
+
+	if q.ReleaseFrom != "" {
+		from, err = time.Parse("2006-01-02", q.ReleaseFrom)
+		v.Check(err == nil, "release_from", "must be a date formatted as YYYY-MM-DD")
+	}
+	if q.ReleaseTo != "" {
+		to, err = time.Parse("2006-01-02", q.ReleaseTo)
+		v.Check(err == nil, "release_to", "must be a date formatted as YYYY-MM-DD")
+	}
+	v.Check(from.IsZero() || to.IsZero() || !to.Before(from), "release_to", "must not be before release_from")
+
+	v.Check(q.Year == 0 || (q.Year >= 1888 && q.Year <= 9999), "year", "must be between 1888 and 9999")
+	// runtime is a smallint, which Postgres won't compare with anything larger
+	v.Check(q.RuntimeMin >= 0 && q.RuntimeMin <= math.MaxInt16, "runtime_min", "must be between 0 and 32767")
+	v.Check(q.RuntimeMax >= 0 && q.RuntimeMax <= math.MaxInt16, "runtime_max", "must be between 0 and 32767")
+	v.Check(q.RuntimeMax == 0 || q.RuntimeMin <= q.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	v.Check(q.PopularityMin >= 0, "popularity_min", "must not be negative")
+	v.Check(q.PopularityMax >= 0, "popularity_max", "must not be negative")
+	v.Check(q.PopularityMax == 0 || q.PopularityMin <= q.PopularityMax, "popularity_max", "must not be less than popularity_min")
+}
+
+// where returns the WHERE clause for the query, with its arguments starting at $1.
+func (q MovieQuery) where() (string, []interface{}) {
+	clause := `WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		  AND (genres @> $2 OR $2 = '{}')
+		  AND (release_date >= $3 OR $3 IS NULL)
+		  AND (release_date <= $4 OR $4 IS NULL)
+		  AND (date_part('year', release_date) = $5 OR $5 = 0)
+		  AND (runtime >= $6 OR $6 = 0)
+		  AND (runtime <= $7 OR $7 = 0)
+		  AND (popularity >= $8 OR $8 = 0)
+		  AND (popularity <= $9 OR $9 = 0)`
+
+	var from, to interface{}
+	if q.ReleaseFrom != "" {
+		from = q.ReleaseFrom
+	}
+	if q.ReleaseTo != "" {
+		to = q.ReleaseTo
+	}
+
+	genres := q.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+
+	args := []interface{}{q.Title, pq.Array(genres), from, to, q.Year, q.RuntimeMin, q.RuntimeMax, q.PopularityMin, q.PopularityMax}
+	return clause, args
+}
+
 type MovieModel struct {
 	DB *sql.DB
 }
@@ -60,7 +133,91 @@ func (m MovieModel) Insert(mv *Movie) error {
 		  RETURNING id, created_at, version`
 
 	args := []interface{}{mv.IdTMDB, mv.Title, mv.Overview, mv.ReleaseDate, mv.Runtime, pq.Array(mv.Genres), mv.Popularity, mv.PosterPath}
-	return m.DB.QueryRow(q, args...).Scan(&mv.Id, &mv.CreatedAt, &mv.Version)
+	err := m.DB.QueryRow(q, args...).Scan(&mv.Id, &mv.CreatedAt, &mv.Version)
+	if err != nil {
+		switch {
+		case isDuplicateTMDBID(err):
+			return ErrDuplicateTMDBID
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func isDuplicateTMDBID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "movies_id_tmdb_key"
+}
+
+// Upsert inserts the movie, or updates the movie with the same id_tmdb in place.
+// It reports whether a new row was created.
+func (m MovieModel) Upsert(mv *Movie) (bool, error) {
+	inserted, err := m.UpsertBatch([]*Movie{mv})
+	if err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			return false, batchErr.Err
+		}
+		return false, err
+	}
+	return inserted[0], nil
+}
+
+// BatchError is returned by UpsertBatch when the movie at Index could not be
+// written, which rolls back the whole batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("movie %d of the batch: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// UpsertBatch upserts the movies in a single transaction, reporting for each of
+// them whether a new row was created.
+func (m MovieModel) UpsertBatch(movies []*Movie) ([]bool, error) {
+	q := `INSERT INTO movies (id_tmdb, title, overview, release_date, runtime, genres, popularity, poster_path)
+		  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		  ON CONFLICT (id_tmdb) DO UPDATE
+		  SET title = EXCLUDED.title, overview = EXCLUDED.overview, release_date = EXCLUDED.release_date,
+		  runtime = EXCLUDED.runtime, genres = EXCLUDED.genres, popularity = EXCLUDED.popularity,
+		  poster_path = EXCLUDED.poster_path, version = movies.version + 1
+		  RETURNING id, created_at, version, xmax = 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	inserted := make([]bool, len(movies))
+	for i, mv := range movies {
+		args := []interface{}{mv.IdTMDB, mv.Title, mv.Overview, mv.ReleaseDate, mv.Runtime, pq.Array(mv.Genres), mv.Popularity, mv.PosterPath}
+		err = stmt.QueryRowContext(ctx, args...).Scan(&mv.Id, &mv.CreatedAt, &mv.Version, &inserted[i])
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
@@ -68,7 +225,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	q := `SELECT *
+	q := `SELECT id, id_tmdb, title, overview, to_char(release_date, 'YYYY-MM-DD'), runtime, genres, popularity, poster_path, created_at, version
 		  FROM movies
 		  WHERE id = $1`
 
@@ -100,18 +257,18 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &mv, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	q := fmt.Sprintf(`SELECT count(*) OVER(), *
+func (m MovieModel) GetAll(query MovieQuery, filters Filters) ([]*Movie, Metadata, error) {
+	where, args := query.where()
+	q := fmt.Sprintf(`SELECT count(*) OVER(), id, id_tmdb, title, overview, to_char(release_date, 'YYYY-MM-DD'), runtime, genres, popularity, poster_path, created_at, version
 		  FROM movies
-		  WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		  AND (genres @> $2 OR $2 = '{}')
+		  %s
 		  ORDER BY %s %s, id ASC
-	      LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	      LIMIT $10 OFFSET $11`, where, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args = append(args, filters.limit(), filters.offset())
 	rows, err := m.DB.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -154,6 +311,79 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// Export passes every movie matching the query to fn, in the order of
+// filters.Sort. The movies are read through a server side cursor in batches, so
+// the result set never has to fit in memory.
+func (m MovieModel) Export(ctx context.Context, query MovieQuery, filters Filters, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := query.where()
+	q := fmt.Sprintf(`DECLARE movies_export NO SCROLL CURSOR FOR
+		  SELECT id, id_tmdb, title, overview, to_char(release_date, 'YYYY-MM-DD'), runtime, genres, popularity, poster_path, created_at, version
+		  FROM movies
+		  %s
+		  ORDER BY %s %s, id ASC`, where, filters.sortColumn(), filters.sortDirection())
+
+	_, err = tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := m.fetchExport(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m MovieModel) fetchExport(ctx context.Context, tx *sql.Tx, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, `FETCH 500 FROM movies_export`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var movie Movie
+		var gnrs []sql.NullString
+		err := rows.Scan(
+			&movie.Id,
+			&movie.IdTMDB,
+			&movie.Title,
+			&movie.Overview,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			pq.Array(&gnrs),
+			&movie.Popularity,
+			&movie.PosterPath,
+			&movie.CreatedAt,
+			&movie.Version,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		movie.SanitizeGenres(gnrs)
+		err = fn(&movie)
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
 func (m MovieModel) Update(mv *Movie) error {
 	q := `UPDATE movies
 		  SET id_tmdb = $2, title = $3, overview = $4, release_date = $5, runtime = $6, popularity = $7, poster_path = $8, genres = $9, version = version + 1
@@ -171,6 +401,8 @@ func (m MovieModel) Update(mv *Movie) error {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case isDuplicateTMDBID(err):
+			return ErrDuplicateTMDBID
 		default:
 			return err
 		}
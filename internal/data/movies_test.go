@@ -0,0 +1,40 @@
+package data
+
+import (
+	"github.com/DARKestMODE/movify/internal/validator"
+	"testing"
+)
+
+func TestValidateMovieQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     MovieQuery
+		wantError string
+	}{
+		{"empty", MovieQuery{}, ""},
+		{"release range", MovieQuery{ReleaseFrom: "1999-01-01", ReleaseTo: "1999-12-31"}, ""},
+		{"release range reversed", MovieQuery{ReleaseFrom: "1999-12-31", ReleaseTo: "1999-01-01"}, "release_to"},
+		{"invalid release date", MovieQuery{ReleaseFrom: "1999-13-01"}, "release_from"},
+		{"year before films", MovieQuery{Year: 1887}, "year"},
+		{"largest runtime", MovieQuery{RuntimeMin: 32767, RuntimeMax: 32767}, ""},
+		{"runtime_min past smallint", MovieQuery{RuntimeMin: 40000}, "runtime_min"},
+		{"runtime_max past smallint", MovieQuery{RuntimeMax: 40000}, "runtime_max"},
+		{"negative runtime", MovieQuery{RuntimeMin: -1}, "runtime_min"},
+		{"runtime range reversed", MovieQuery{RuntimeMin: 120, RuntimeMax: 90}, "runtime_max"},
+		{"popularity range reversed", MovieQuery{PopularityMin: 5, PopularityMax: 1}, "popularity_max"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateMovieQuery(v, tt.query)
+
+			switch {
+			case tt.wantError == "" && !v.Valid():
+				t.Errorf("got errors %v; want none", v.Errors)
+			case tt.wantError != "" && v.Errors[tt.wantError] == "":
+				t.Errorf("got errors %v; want one for %s", v.Errors, tt.wantError)
+			}
+		})
+	}
+}
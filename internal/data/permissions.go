@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"github.com/DARKestMODE/movify/internal/validator"
 	"github.com/lib/pq"
 	"time"
 )
@@ -18,27 +19,88 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+func (p Permissions) Intersect(codes []string) Permissions {
+	permissions := Permissions{}
+	for _, code := range codes {
+		if p.Include(code) {
+			permissions = append(permissions, code)
+		}
+	}
+	return permissions
+}
+
+// ValidatePermissionCodes checks that every code is one of the known permissions.
+func ValidatePermissionCodes(v *validator.Validator, codes []string, known Permissions) {
+	v.Check(len(codes) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(codes), "permissions", "must not contain duplicate values")
+	for _, code := range codes {
+		v.Check(known.Include(code), "permissions", "must only contain known permission codes")
+	}
+}
+
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *PermissionCache
+}
+
+func (m PermissionModel) GetAll() (Permissions, error) {
+	q := `SELECT code
+		  FROM permissions
+		  ORDER BY code`
+
+	return m.query(q)
 }
 
+// GetAllForUser resolves the permissions granted to the user directly as well as
+// through their roles.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	if permissions, found := m.Cache.get(userID); found {
+		return permissions, nil
+	}
+	generation := m.Cache.snapshot()
+
 	q := `SELECT p.code
 		  FROM permissions p
 		  INNER JOIN users_permissions up ON up.permission_id = p.id
-		  INNER JOIN users u ON up.user_id = u.id
-		  WHERE u.id = $1`
+		  WHERE up.user_id = $1
+		  UNION
+		  SELECT p.code
+		  FROM permissions p
+		  INNER JOIN roles_permissions rp ON rp.permission_id = p.id
+		  INNER JOIN users_roles ur ON ur.role_id = rp.role_id
+		  WHERE ur.user_id = $1
+		  ORDER BY 1`
+
+	permissions, err := m.query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Cache.set(userID, generation, permissions)
+	return permissions, nil
+}
 
+func (m PermissionModel) GetDirectForUser(userID int64) (Permissions, error) {
+	q := `SELECT p.code
+		  FROM permissions p
+		  INNER JOIN users_permissions up ON up.permission_id = p.id
+		  WHERE up.user_id = $1
+		  ORDER BY p.code`
+
+	return m.query(q, userID)
+}
+
+func (m PermissionModel) query(q string, args ...interface{}) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, q, userID)
+	rows, err := m.DB.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permission string
 		err := rows.Scan(&permission)
@@ -55,11 +117,35 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	q := `INSERT INTO users_permissions
-		  SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		  SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		  ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, q, userID, pq.Array(codes))
-	return err
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+	return nil
+}
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	q := `DELETE FROM users_permissions up
+		  USING permissions p
+		  WHERE up.permission_id = p.id
+		  AND up.user_id = $1 AND p.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+	return nil
 }
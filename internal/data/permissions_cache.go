@@ -0,0 +1,150 @@
+package data
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermissionCache keeps the resolved permissions of recently seen users in memory.
+// Grants and revocations made through the models invalidate it right away, changes
+// made elsewhere (or by other instances) show up once the entry expires.
+type PermissionCache struct {
+	hits    int64 // accessed atomically, kept first for 64-bit alignment
+	misses  int64
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[int64]permissionCacheEntry
+
+	// generation is bumped by every invalidation and invalidated remembers the
+	// generation at which each user was last invalidated, so that a lookup which
+	// raced an invalidation doesn't put what it read back into the cache.
+	generation  uint64
+	invalidated map[int64]uint64
+	pruned      uint64
+}
+
+type permissionCacheEntry struct {
+	permissions Permissions
+	expiry      time.Time
+}
+
+type PermissionCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// NewPermissionCache returns a cache holding entries for ttl; a zero ttl disables
+// caching.
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		ttl:         ttl,
+		entries:     make(map[int64]permissionCacheEntry),
+		invalidated: make(map[int64]uint64),
+	}
+}
+
+func (c *PermissionCache) get(userID int64) (Permissions, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[userID]
+	if !found || time.Now().After(entry.expiry) {
+		delete(c.entries, userID)
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+	return append(Permissions{}, entry.permissions...), true
+}
+
+// snapshot returns the current generation, to be passed to set along with the
+// permissions read after it was taken.
+func (c *PermissionCache) snapshot() uint64 {
+	if c == nil || c.ttl <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *PermissionCache) set(userID int64, generation uint64, permissions Permissions) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.invalidated[userID] > generation {
+		return
+	}
+
+	c.entries[userID] = permissionCacheEntry{
+		permissions: append(Permissions{}, permissions...),
+		expiry:      time.Now().Add(c.ttl),
+	}
+}
+
+func (c *PermissionCache) Invalidate(userID int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+
+	c.generation++
+	c.invalidated[userID] = c.generation
+}
+
+func (c *PermissionCache) Prune() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for userID, entry := range c.entries {
+		if now.After(entry.expiry) {
+			delete(c.entries, userID)
+		}
+	}
+
+	// lookups time out long before the next prune, so invalidations older than
+	// the previous one can't race anything anymore
+	for userID, generation := range c.invalidated {
+		if generation <= c.pruned {
+			delete(c.invalidated, userID)
+		}
+	}
+	c.pruned = c.generation
+	return nil
+}
+
+func (c *PermissionCache) Stats() PermissionCacheStats {
+	if c == nil {
+		return PermissionCacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return PermissionCacheStats{
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Entries: entries,
+	}
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPermissionCacheInvalidateDuringLookup(t *testing.T) {
+	c := NewPermissionCache(time.Minute)
+
+	// a lookup reads the old permissions while they are being revoked
+	generation := c.snapshot()
+	c.Invalidate(1)
+	c.set(1, generation, Permissions{"movies:write"})
+
+	if permissions, found := c.get(1); found {
+		t.Errorf("got %v cached after an invalidation; want a miss", permissions)
+	}
+
+	// the next lookup starts after the revocation and is cached
+	generation = c.snapshot()
+	c.set(1, generation, Permissions{"movies:read"})
+
+	permissions, found := c.get(1)
+	if !found || !permissions.Include("movies:read") {
+		t.Errorf("got %v, %t; want [movies:read], true", permissions, found)
+	}
+
+	// invalidating another user doesn't hold back lookups of the first one
+	generation = c.snapshot()
+	c.Invalidate(2)
+	c.set(1, generation, Permissions{"movies:read"})
+
+	if _, found := c.get(1); !found {
+		t.Error("got a miss after invalidating another user")
+	}
+}
+
+func TestPermissionCachePrune(t *testing.T) {
+	c := NewPermissionCache(time.Minute)
+	c.Invalidate(1)
+
+	c.Prune()
+	if _, found := c.invalidated[1]; !found {
+		t.Error("invalidation was pruned before a full interval passed")
+	}
+
+	c.Prune()
+	if _, found := c.invalidated[1]; found {
+		t.Error("invalidation was not pruned after a full interval")
+	}
+
+	c.set(1, c.snapshot(), Permissions{"movies:read"})
+	if _, found := c.get(1); !found {
+		t.Error("got a miss after pruning")
+	}
+}
+
+func TestPermissionCacheDisabled(t *testing.T) {
+	for _, c := range []*PermissionCache{nil, NewPermissionCache(0)} {
+		c.set(1, c.snapshot(), Permissions{"movies:read"})
+		if _, found := c.get(1); found {
+			t.Error("got a hit from a disabled cache")
+		}
+		c.Invalidate(1)
+	}
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DARKestMODE/movify/internal/validator"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Role is a named bundle of permission codes.
+type Role struct {
+	Name        string         `json:"name"`
+	Permissions pq.StringArray `json:"permissions"`
+}
+
+func ValidateRoleNames(v *validator.Validator, names []string, known []*Role) {
+	v.Check(len(names) >= 1, "roles", "must contain at least 1 role")
+	v.Check(validator.Unique(names), "roles", "must not contain duplicate values")
+
+	knownNames := make([]string, len(known))
+	for i, role := range known {
+		knownNames[i] = role.Name
+	}
+	for _, name := range names {
+		v.Check(validator.In(name, knownNames...), "roles", "must only contain known role names")
+	}
+}
+
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *PermissionCache
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+	q := `SELECT r.name, COALESCE(array_agg(p.code ORDER BY p.code) FILTER (WHERE p.code IS NOT NULL), '{}')
+		  FROM roles r
+		  LEFT JOIN roles_permissions rp ON rp.role_id = r.id
+		  LEFT JOIN permissions p ON p.id = rp.permission_id
+		  GROUP BY r.id
+		  ORDER BY r.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.Name, &role.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	q := `SELECT r.name
+		  FROM roles r
+		  INNER JOIN users_roles ur ON ur.role_id = r.id
+		  WHERE ur.user_id = $1
+		  ORDER BY r.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+	q := `INSERT INTO users_roles
+		  SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+		  ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+	return nil
+}
+
+func (m RoleModel) RemoveForUser(userID int64, names ...string) error {
+	q := `DELETE FROM users_roles ur
+		  USING roles r
+		  WHERE ur.role_id = r.id
+		  AND ur.user_id = $1 AND r.name = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+	return nil
+}
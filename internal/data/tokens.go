@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"github.com/DARKestMODE/movify/internal/validator"
 	"time"
 )
@@ -13,6 +14,16 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeMFA            = "mfa"
+	ScopeEmailChange    = "email-change"
+	ScopeAccountRestore = "account-restore"
+	ScopeMagicLink      = "magic-link"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
@@ -21,6 +32,20 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	Family    []byte    `json:"-"`
+	UserAgent string    `json:"-"`
+	ClientIP  string    `json:"-"`
+}
+
+type Session struct {
+	ID         int64      `json:"id"`
+	Hash       []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	ClientIP   string     `json:"client_ip"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -44,6 +69,15 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+func GenerateFamily() ([]byte, error) {
+	family := make([]byte, 16)
+	_, err := rand.Read(family)
+	if err != nil {
+		return nil, err
+	}
+	return family, nil
+}
+
 type TokenModel struct {
 	DB *sql.DB
 }
@@ -63,11 +97,112 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession creates an authentication token. Tokens sharing a family belong to the
+// same login and are revoked together; a nil family starts a new one.
+func (m TokenModel) NewSession(userID int64, ttl time.Duration, family []byte, userAgent, clientIP string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	if family == nil {
+		family, err = GenerateFamily()
+		if err != nil {
+			return nil, err
+		}
+	}
+	token.Family = family
+	token.UserAgent = userAgent
+	token.ClientIP = clientIP
+
+	err = m.Insert(token)
+	return token, err
+}
+
+// NewRefresh creates a refresh token expiring at expiry, which rotations carry
+// over so that a family ends a fixed time after the login that started it.
+func (m TokenModel) NewRefresh(userID int64, expiry time.Time, family []byte) (*Token, error) {
+	token, err := generateToken(userID, time.Until(expiry), ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	token.Expiry = expiry
+	token.Family = family
+
+	err = m.Insert(token)
+	return token, err
+}
+
+// UseRefresh marks a refresh token as used and returns it, removing the session it
+// was issued with, which the refresh replaces. Presenting a token which has
+// already been used revokes its whole family and returns ErrTokenReused.
+func (m TokenModel) UseRefresh(tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := `SELECT user_id, expiry, family, used_at
+		  FROM tokens
+		  WHERE hash = $1 AND scope = $2
+		  FOR UPDATE`
+
+	token := Token{
+		Plaintext: tokenPlaintext,
+		Hash:      tokenHash[:],
+		Scope:     ScopeRefresh,
+	}
+	var usedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, q, token.Hash, ScopeRefresh).Scan(&token.UserID, &token.Expiry, &token.Family, &usedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if usedAt.Valid {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, token.Family)
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &token, ErrTokenReused
+	}
+
+	if !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, token.Hash)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1 AND scope = $2`, token.Family, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
 func (m TokenModel) Insert(token *Token) error {
-	q := `INSERT INTO tokens (hash, user_id, expiry, scope)
-		  VALUES ($1, $2, $3, $4)`
+	q := `INSERT INTO tokens (hash, user_id, expiry, scope, family, user_agent, client_ip)
+		  VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family, token.UserAgent, token.ClientIP}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -85,3 +220,121 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, q, scope, userID)
 	return err
 }
+
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	q := `DELETE FROM tokens
+		  WHERE scope IN ($1, $2) AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, ScopeAuthentication, ScopeRefresh, userID)
+	return err
+}
+
+// DeleteByHash removes the token together with every token of its family and
+// returns that family.
+func (m TokenModel) DeleteByHash(hash []byte) ([]byte, error) {
+	q := `DELETE FROM tokens t
+		  USING tokens s
+		  WHERE s.hash = $1
+		  AND (t.hash = s.hash OR t.family = s.family)
+		  RETURNING s.family`
+
+	return m.deleteFamily(q, hash)
+}
+
+func (m TokenModel) Touch(hash []byte, interval time.Duration) error {
+	q := `UPDATE tokens
+		  SET last_used_at = NOW()
+		  WHERE hash = $1
+		  AND (last_used_at IS NULL OR last_used_at < $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, hash, time.Now().Add(-interval))
+	return err
+}
+
+func (m TokenModel) GetAllSessionsForUser(userID int64) ([]*Session, error) {
+	q := `SELECT id, hash, created_at, last_used_at, expiry, user_agent, client_ip
+		  FROM tokens
+		  WHERE user_id = $1
+		  AND scope = $2
+		  AND expiry > $3
+		  ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q, userID, ScopeAuthentication, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.Hash,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.ClientIP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m TokenModel) DeleteSession(id, userID int64) ([]byte, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	q := `DELETE FROM tokens t
+		  USING tokens s
+		  WHERE s.id = $1 AND s.user_id = $2 AND s.scope = $3
+		  AND (t.id = s.id OR t.family = s.family)
+		  RETURNING s.family`
+
+	return m.deleteFamily(q, id, userID, ScopeAuthentication)
+}
+
+func (m TokenModel) deleteFamily(q string, args ...interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var family []byte
+	found := false
+	for rows.Next() {
+		found = true
+		if err := rows.Scan(&family); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrRecordNotFound
+	}
+
+	return family, nil
+}
@@ -5,7 +5,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/DARKestMODE/movify/internal/strength"
 	"github.com/DARKestMODE/movify/internal/validator"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
@@ -13,22 +16,32 @@ import (
 var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 	AnonymousUser     = &User{}
+
+	// PasswordMinEntropy is the estimated entropy in bits a new password needs.
+	PasswordMinEntropy = 40.0
 )
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Password   password   `json:"-"`
+	Activated  bool       `json:"activated"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	Version    int        `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// IsDisabled reports whether an administrator suspended the account, which is
+// independent of whether it was ever activated.
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -36,7 +49,13 @@ func ValidateEmail(v *validator.Validator, email string) {
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= 256, "password", "must not be more than 256 bytes long")
+}
+
+// ValidatePasswordStrength rejects new passwords that are easy to guess, taking
+// into account what an attacker knows about the user, such as their name or email.
+func ValidatePasswordStrength(v *validator.Validator, password string, userInputs ...string) {
+	v.Check(strength.Entropy(password, userInputs...) >= PasswordMinEntropy, "password", "is too easy to guess, avoid common words, your name and your email address")
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -45,6 +64,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	ValidateEmail(v, user.Email)
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidatePasswordStrength(v, *user.Password.plaintext, user.Name, user.Email)
 	}
 
 	if user.Password.hash == nil {
@@ -52,6 +72,11 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
+func isDuplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key"
+}
+
 type UserModel struct {
 	DB *sql.DB
 }
@@ -68,7 +93,7 @@ func (m UserModel) Insert(user *User) error {
 	err := m.DB.QueryRowContext(ctx, q, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: повторяющееся значение ключа нарушает ограничение уникальности "users_email_key"`:
+		case isDuplicateEmail(err):
 			return ErrDuplicateEmail
 		default:
 			return err
@@ -78,9 +103,9 @@ func (m UserModel) Insert(user *User) error {
 }
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
-	q := `SELECT id, created_at, name, email, password_hash, activated, version
+	q := `SELECT id, created_at, name, email, password_hash, activated, disabled_at, version
 		  FROM users
-		  WHERE email = $1`
+		  WHERE email = $1 AND deleted_at IS NULL`
 
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -93,6 +118,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DisabledAt,
 		&user.Version,
 	)
 	if err != nil {
@@ -106,10 +132,95 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	q := `SELECT id, created_at, name, email, password_hash, activated, disabled_at, version
+		  FROM users
+		  WHERE id = $1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DisabledAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetAll lists accounts which aren't pending deletion. An empty search matches
+// everyone, otherwise it must be contained in the name or email.
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	q := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, disabled_at, version
+		  FROM users
+		  WHERE deleted_at IS NULL
+		  AND (position(lower($1) in lower(name || ' ' || email)) > 0 OR $1 = '')
+		  AND (activated = $2 OR $2 IS NULL)
+		  ORDER BY %s %s, id ASC
+		  LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{search, activated, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.DisabledAt,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 func (m UserModel) Update(user *User) error {
 	q := `UPDATE users
-		  SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		  WHERE id = $5 AND version = $6
+		  SET name = $1, email = $2, password_hash = $3, activated = $4, disabled_at = $5, version = version + 1
+		  WHERE id = $6 AND version = $7
 		  RETURNING version`
 
 	args := []interface{}{
@@ -117,6 +228,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.DisabledAt,
 		user.ID,
 		user.Version,
 	}
@@ -126,7 +238,7 @@ func (m UserModel) Update(user *User) error {
 	err := m.DB.QueryRowContext(ctx, q, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case isDuplicateEmail(err):
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -140,7 +252,7 @@ func (m UserModel) Update(user *User) error {
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
-	q := `SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version
+	q := `SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.disabled_at, u.version
 		  FROM users u
 		  INNER JOIN tokens
 		  ON u.id = tokens.user_id
@@ -160,6 +272,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DisabledAt,
 		&user.Version,
 	)
 	if err != nil {
@@ -174,13 +287,128 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
+// SetPendingEmail remembers the address a user wants to switch to until they
+// confirm it; an empty email clears it.
+func (m UserModel) SetPendingEmail(userID int64, email string) error {
+	q := `UPDATE users
+		  SET pending_email = NULLIF($1, '')
+		  WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, q, email, userID)
+	return err
+}
+
+func (m UserModel) GetPendingEmail(userID int64) (string, error) {
+	q := `SELECT COALESCE(pending_email, '')
+		  FROM users
+		  WHERE id = $1`
+
+	var email string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, q, userID).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return email, nil
+}
+
+// SoftDelete hides the account and drops every credential giving access to it.
+// The row itself is removed by PurgeDeleted once the grace period is over.
+func (m UserModel) SoftDelete(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := `UPDATE users
+		  SET deleted_at = NOW(), version = version + 1
+		  WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m UserModel) Restore(userID int64) error {
+	q := `UPDATE users
+		  SET deleted_at = NULL, version = version + 1
+		  WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes accounts soft-deleted before the given time;
+// everything referencing them goes with them through ON DELETE CASCADE.
+func (m UserModel) PurgeDeleted(before time.Time) (int64, error) {
+	q := `DELETE FROM users
+		  WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, q, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := hashArgon2id(plaintextPassword, PasswordParams)
 	if err != nil {
 		return err
 	}
@@ -189,7 +417,13 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches verifies the password against an Argon2id hash, or a bcrypt hash
+// created before Argon2id became the default.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if isArgon2id(p.hash) {
+		return matchesArgon2id(p.hash, plaintextPassword)
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		switch {
@@ -201,3 +435,14 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	}
 	return true, nil
 }
+
+// NeedsRehash reports whether the hash was made with another algorithm or with
+// parameters other than PasswordParams.
+func (p *password) NeedsRehash() bool {
+	if !isArgon2id(p.hash) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2id(p.hash)
+	return err != nil || params != PasswordParams
+}
@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist holds revoked sessions and users in memory so that signed tokens can be
+// rejected without a database round-trip.
+type Denylist struct {
+	mu       sync.RWMutex
+	sessions map[string]time.Time
+	users    map[int64]time.Time
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{
+		sessions: make(map[string]time.Time),
+		users:    make(map[int64]time.Time),
+	}
+}
+
+func (d *Denylist) AddSession(sid string, expiry time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessions[sid] = expiry
+}
+
+// AddUser revokes every token of the user issued before revokedAt.
+func (d *Denylist) AddUser(userID int64, revokedAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if revokedAt.After(d.users[userID]) {
+		d.users[userID] = revokedAt
+	}
+}
+
+func (d *Denylist) Revoked(c *Claims, userID int64) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, found := d.sessions[c.Session]; found {
+		return true
+	}
+	if revokedAt, found := d.users[userID]; found && c.IssuedAt < unixSeconds(revokedAt) {
+		return true
+	}
+	return false
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// Prune drops session entries whose tokens have expired anyway and user entries
+// older than maxAge, the lifetime of a token.
+func (d *Denylist) Prune(now time.Time, maxAge time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for sid, expiry := range d.sessions {
+		if now.After(expiry) {
+			delete(d.sessions, sid)
+		}
+	}
+	for userID, revokedAt := range d.users {
+		if now.Sub(revokedAt) > maxAge {
+			delete(d.users, userID)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// Claims are the claims of a signed token. IssuedAt keeps a fraction of a second,
+// which NumericDate allows, so that a token issued right after a revocation is
+// told apart from the tokens it revoked.
+type Claims struct {
+	Subject     string   `json:"sub"`
+	ID          string   `json:"jti"`
+	IssuedAt    float64  `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+	Session     string   `json:"sid"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+}
+
+func (c *Claims) UserID() (int64, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+// ParseKey reads a key in the "kid:base64" form. HS256 keys are raw secrets of at
+// least 32 bytes, EdDSA keys are 32 byte Ed25519 seeds.
+func ParseKey(algorithm, spec string) (Key, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Key{}, fmt.Errorf("jwt: key must be in the kid:base64 form")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Key{}, fmt.Errorf("jwt: key %q is not valid base64", parts[0])
+	}
+
+	key := Key{ID: parts[0], Algorithm: algorithm}
+	switch algorithm {
+	case AlgorithmHS256:
+		if len(raw) < 32 {
+			return Key{}, fmt.Errorf("jwt: key %q must be at least 32 bytes long", key.ID)
+		}
+		key.secret = raw
+	case AlgorithmEdDSA:
+		if len(raw) != ed25519.SeedSize {
+			return Key{}, fmt.Errorf("jwt: key %q must be %d bytes long", key.ID, ed25519.SeedSize)
+		}
+		key.private = ed25519.NewKeyFromSeed(raw)
+		key.public = key.private.Public().(ed25519.PublicKey)
+	default:
+		return Key{}, fmt.Errorf("jwt: unsupported algorithm %q", algorithm)
+	}
+	return key, nil
+}
+
+func (k Key) sign(input []byte) []byte {
+	if k.Algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(k.private, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	if k.Algorithm == AlgorithmEdDSA {
+		return ed25519.Verify(k.public, input, signature)
+	}
+	return hmac.Equal(k.sign(input), signature)
+}
+
+// Keyring signs with its first key and verifies with any key, selected by the kid
+// header, so keys can be rotated by prepending a new one.
+type Keyring struct {
+	keys []Key
+}
+
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: at least one key must be provided")
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+func (kr *Keyring) Sign(claims *Claims) (string, error) {
+	key := kr.keys[0]
+
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encode(h) + "." + encode(c)
+	return input + "." + encode(key.sign([]byte(input))), nil
+}
+
+func (kr *Keyring) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, ok := kr.lookup(h.KeyID)
+	if !ok || key.Algorithm != h.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+func (kr *Keyring) lookup(kid string) (Key, bool) {
+	for _, key := range kr.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string, dst interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
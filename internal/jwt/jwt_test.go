@@ -0,0 +1,265 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T, algorithm, kid string, fill byte) Key {
+	t.Helper()
+
+	key, err := ParseKey(algorithm, kid+":"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testClaims(now time.Time) *Claims {
+	return &Claims{
+		Subject:     "42",
+		ID:          "jti",
+		IssuedAt:    float64(now.Unix()),
+		ExpiresAt:   now.Add(time.Minute).Unix(),
+		Session:     "sid",
+		Activated:   true,
+		Permissions: []string{"movies:read"},
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		spec      string
+		wantErr   bool
+	}{
+		{"HS256", AlgorithmHS256, "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)), false},
+		{"HS256 too short", AlgorithmHS256, "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 31)), true},
+		{"EdDSA", AlgorithmEdDSA, "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)), false},
+		{"EdDSA wrong size", AlgorithmEdDSA, "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 64)), true},
+		{"missing kid", AlgorithmHS256, ":" + base64.StdEncoding.EncodeToString(make([]byte, 32)), true},
+		{"missing separator", AlgorithmHS256, base64.StdEncoding.EncodeToString(make([]byte, 32)), true},
+		{"invalid base64", AlgorithmHS256, "k1:not base64!", true},
+		{"unsupported algorithm", "RS256", "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(tt.algorithm, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v; want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Now()
+
+	for _, algorithm := range []string{AlgorithmHS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			kr, err := NewKeyring(testKey(t, algorithm, "k1", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := kr.Sign(testClaims(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := kr.Verify(token, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			userID, err := claims.UserID()
+			if err != nil || userID != 42 {
+				t.Errorf("got user id %d, %v; want 42", userID, err)
+			}
+			if claims.Session != "sid" || !claims.Activated || len(claims.Permissions) != 1 {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+
+	kr, err := NewKeyring(testKey(t, AlgorithmHS256, "k1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := kr.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	other, err := NewKeyring(testKey(t, AlgorithmHS256, "k1", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := other.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknownKid, err := NewKeyring(testKey(t, AlgorithmHS256, "k2", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := unknownKid.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eddsa, err := NewKeyring(testKey(t, AlgorithmEdDSA, "k1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongAlgorithm, err := eddsa.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", token, now, nil},
+		{"expired", token, now.Add(time.Minute), ErrExpiredToken},
+		{"wrong secret", forged, now, ErrInvalidToken},
+		{"unknown kid", unknown, now, ErrInvalidToken},
+		{"algorithm mismatch", wrongAlgorithm, now, ErrInvalidToken},
+		{"tampered claims", parts[0] + "." + encode([]byte(`{"sub":"1","exp":9999999999}`)) + "." + parts[2], now, ErrInvalidToken},
+		{"missing signature", parts[0] + "." + parts[1], now, ErrInvalidToken},
+		{"garbage", "a.b.c", now, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.Verify(tt.token, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	now := time.Now()
+	oldKey := testKey(t, AlgorithmHS256, "old", 1)
+	newKey := testKey(t, AlgorithmEdDSA, "new", 2)
+
+	before, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyring(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := rotated.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h header
+	err = decode(strings.Split(newToken, ".")[0], &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.KeyID != "new" || h.Algorithm != AlgorithmEdDSA {
+		t.Errorf("got header %+v; want the first key to sign", h)
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		_, err := rotated.Verify(token, now)
+		if err != nil {
+			t.Errorf("%s token: got error %v", name, err)
+		}
+	}
+
+	_, err = before.Verify(newToken, now)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidToken)
+	}
+
+	_, err = NewKeyring()
+	if err == nil {
+		t.Error("got no error for an empty keyring")
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	revokedAt := time.Date(2024, 1, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	d := NewDenylist()
+	d.AddSession("revoked", revokedAt.Add(time.Hour))
+	d.AddUser(1, revokedAt)
+	d.AddUser(1, revokedAt.Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		session  string
+		userID   int64
+		issuedAt time.Time
+		want     bool
+	}{
+		{"revoked session", "revoked", 2, revokedAt.Add(time.Hour), true},
+		{"other user", "sid", 2, revokedAt.Add(-time.Hour), false},
+		{"issued before revocation", "sid", 1, revokedAt.Add(-time.Second), true},
+		{"issued earlier in the same second", "sid", 1, revokedAt.Add(-time.Millisecond), true},
+		{"issued later in the same second", "sid", 1, revokedAt.Add(time.Millisecond), false},
+		{"issued after revocation", "sid", 1, revokedAt.Add(time.Second), false},
+		{"whole second iat before revocation", "sid", 1, revokedAt.Truncate(time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claims{Session: tt.session, IssuedAt: float64(tt.issuedAt.UnixNano()/1e3) / 1e6}
+			if got := d.Revoked(c, tt.userID); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenylistPrune(t *testing.T) {
+	now := time.Now()
+
+	d := NewDenylist()
+	d.AddSession("expired", now.Add(-time.Second))
+	d.AddSession("active", now.Add(time.Minute))
+	d.AddUser(1, now.Add(-2*time.Hour))
+	d.AddUser(2, now.Add(-time.Minute))
+
+	d.Prune(now, time.Hour)
+
+	if _, found := d.sessions["expired"]; found {
+		t.Error("expired session was not pruned")
+	}
+	if _, found := d.sessions["active"]; !found {
+		t.Error("active session was pruned")
+	}
+	if _, found := d.users[1]; found {
+		t.Error("old user entry was not pruned")
+	}
+	if _, found := d.users[2]; !found {
+		t.Error("recent user entry was pruned")
+	}
+}
@@ -0,0 +1,338 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider is an OpenID Connect provider serving discovery, a key set and a
+// token endpoint which checks PKCE. Authorizations are registered directly by the
+// tests in place of the browser round-trip.
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := &fakeProvider{t: t, key: key, authorizations: make(map[string]fakeAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fp.server.URL,
+			"authorization_endpoint": fp.server.URL + "/authorize",
+			"token_endpoint":         fp.server.URL + "/token",
+			"jwks_uri":               fp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "k1",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", fp.token)
+
+	fp.server = httptest.NewServer(mux)
+	t.Cleanup(fp.server.Close)
+	return fp
+}
+
+func (fp *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("invalid_request")
+		return
+	}
+	if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+		fail("invalid_client")
+		return
+	}
+
+	fp.mu.Lock()
+	authorization, found := fp.authorizations[r.PostForm.Get("code")]
+	delete(fp.authorizations, r.PostForm.Get("code"))
+	fp.mu.Unlock()
+
+	if !found || challenge(r.PostForm.Get("code_verifier")) != authorization.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": fp.sign("k1", authorization.claims)})
+}
+
+// authorize stands in for the user approving the request behind authURL, and
+// returns the code the provider would redirect back with.
+func (fp *fakeProvider) authorize(authURL string, claims map[string]interface{}) string {
+	fp.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		fp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		fp.t.Fatalf("got code_challenge_method %q; want S256", q.Get("code_challenge_method"))
+	}
+
+	defaults := map[string]interface{}{
+		"iss":            fp.server.URL,
+		"sub":            "subject-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          q.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	for k, v := range claims {
+		defaults[k] = v
+	}
+
+	code := q.Get("state") + "-code"
+	fp.mu.Lock()
+	fp.authorizations[code] = fakeAuthorization{challenge: q.Get("code_challenge"), claims: defaults}
+	fp.mu.Unlock()
+	return code
+}
+
+func (fp *fakeProvider) sign(kid string, claims map[string]interface{}) string {
+	fp.t.Helper()
+
+	h, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, fp.key, digest[:])
+	if err != nil {
+		fp.t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+type authorization struct {
+	state, nonce, verifier string
+}
+
+func newAuthorization(t *testing.T) authorization {
+	t.Helper()
+
+	var a authorization
+	for _, s := range []*string{&a.state, &a.nonce, &a.verifier} {
+		var err error
+		*s, err = RandomString()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a
+}
+
+func TestExchange(t *testing.T) {
+	fp := newFakeProvider(t)
+	p := NewProvider(Config{
+		Name:         "fake",
+		Issuer:       fp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://movify.example/callback",
+		Scopes:       []string{"openid", "email"},
+	}, nil)
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		redeem  func(issued, other authorization) authorization
+		wantErr error
+		want    *Identity
+	}{
+		{
+			name: "valid",
+			want: &Identity{Subject: "subject-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"},
+		},
+		{
+			name:   "unverified email",
+			claims: map[string]interface{}{"email_verified": "false"},
+			want:   &Identity{Subject: "subject-1", Email: "alice@example.com", EmailVerified: false, Name: "Alice"},
+		},
+		// the provider refuses to redeem the code without the matching PKCE verifier
+		{
+			name:    "wrong code verifier",
+			redeem:  func(issued, other authorization) authorization { issued.verifier = other.verifier; return issued },
+			wantErr: ErrExchangeFailed,
+		},
+		{
+			name:    "code redeemed with another state",
+			redeem:  func(issued, other authorization) authorization { return other },
+			wantErr: ErrExchangeFailed,
+		},
+		{
+			name:    "wrong nonce",
+			redeem:  func(issued, other authorization) authorization { issued.nonce = other.nonce; return issued },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong audience",
+			claims:  map[string]interface{}{"aud": []string{"someone-else"}},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong issuer",
+			claims:  map[string]interface{}{"iss": "https://evil.example"},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "expired",
+			claims:  map[string]interface{}{"exp": time.Now().Add(-2 * leeway).Unix()},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "missing subject",
+			claims:  map[string]interface{}{"sub": ""},
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, other := newAuthorization(t), newAuthorization(t)
+
+			authURL, err := p.AuthCodeURL(context.Background(), issued.state, issued.nonce, issued.verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := fp.authorize(authURL, tt.claims)
+
+			redeemed := issued
+			if tt.redeem != nil {
+				redeemed = tt.redeem(issued, other)
+			}
+
+			identity, err := p.Exchange(context.Background(), code, redeemed.verifier, redeemed.nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *identity != *tt.want {
+				t.Errorf("got identity %+v; want %+v", identity, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeUnknownSigningKey(t *testing.T) {
+	fp := newFakeProvider(t)
+	p := NewProvider(Config{Name: "fake", Issuer: fp.server.URL, ClientID: "client"}, nil)
+
+	token := fp.sign("unknown", map[string]interface{}{
+		"iss": fp.server.URL,
+		"sub": "subject-1",
+		"aud": "client",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	_, err := p.verify(context.Background(), token, time.Now())
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	fp := newFakeProvider(t)
+	p := NewProvider(Config{Name: "fake", Issuer: fp.server.URL, ClientID: "client", RedirectURL: "https://movify.example/callback", Scopes: []string{"openid", "email"}}, nil)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "https://movify.example/callback",
+		"scope":                 "openid email",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        challenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s: got %q; want %q", key, got, value)
+		}
+	}
+	if u.Path != "/authorize" {
+		t.Errorf("got path %q; want /authorize", u.Path)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"complete", "name=google,issuer=https://accounts.google.com/,client-id=id,client-secret=secret,redirect-url=https://movify.example/cb", false},
+		{"custom scopes", "name=g,issuer=https://i,client-id=id,redirect-url=https://r,scopes=openid email", false},
+		{"missing issuer", "name=g,client-id=id,redirect-url=https://r", true},
+		{"auto-link", "name=g,issuer=https://i,client-id=id,redirect-url=https://r,auto-link=true", false},
+		{"invalid auto-link", "name=g,issuer=https://i,client-id=id,redirect-url=https://r,auto-link=yes", true},
+		{"unknown option", "name=g,issuer=https://i,client-id=id,redirect-url=https://r,color=red", true},
+		{"malformed option", "name=g,issuer", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if err == nil && cfg.Issuer[len(cfg.Issuer)-1] == '/' {
+				t.Errorf("got issuer %q with a trailing slash", cfg.Issuer)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package pwned
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// List looks passwords up in a local copy of a breached password corpus, laid out
+// like the Pwned Passwords range API: one file per five character SHA-1 prefix,
+// e.g. 5BAA6.txt, holding "SUFFIX:COUNT" lines for every hash with that prefix.
+type List struct {
+	dir string
+}
+
+func Open(dir string) (*List, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("pwned: %s is not a directory", dir)
+	}
+	return &List{dir: dir}, nil
+}
+
+// Count returns how many times the password appears in the corpus. A missing
+// range file counts as zero occurrences.
+func (l *List) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < len(suffix) || !strings.EqualFold(line[:len(suffix)], suffix) {
+			continue
+		}
+
+		count := 1
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			count, err = strconv.Atoi(line[i+1:])
+			if err != nil {
+				return 0, fmt.Errorf("pwned: malformed line in %s: %q", f.Name(), line)
+			}
+		}
+		return count, nil
+	}
+	return 0, scanner.Err()
+}
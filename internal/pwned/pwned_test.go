@@ -0,0 +1,72 @@
+package pwned
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	files := map[string]string{
+		"5BAA6.txt": "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n",
+		// SHA-1("hunter2") is F3BBBD66A63D4BF1747940578EC3D0103530E21D
+		"F3BBB.txt": "d66a63d4bf1747940578ec3d0103530e21d\n",
+		// SHA-1("123456") is 7C4A8D09CA3762AF61E59520943DC26494F8941B
+		"7C4A8.txt": "D09CA3762AF61E59520943DC26494F8941B:many\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+		wantErr  bool
+	}{
+		{"listed", "password", 9659365, false},
+		{"lowercase hash without count", "hunter2", 1, false},
+		{"not in its range file", "Password", 0, false},
+		{"missing range file", "correct horse battery staple", 0, false},
+		{"malformed count", "123456", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := list.Count(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "5BAA6.txt")
+	err := os.WriteFile(file, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, filepath.Join(dir, "missing")} {
+		_, err := Open(path)
+		if err == nil {
+			t.Errorf("Open(%q): got no error", path)
+		}
+	}
+}
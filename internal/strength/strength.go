@@ -0,0 +1,190 @@
+package strength
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed dictionary.txt
+var dictionaryFile string
+
+// dictionary maps common passwords and words to their rank, most common first.
+var dictionary = func() map[string]int {
+	words := strings.Fields(dictionaryFile)
+	ranks := make(map[string]int, len(words))
+	for i, word := range words {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+}
+
+// Entropy returns an estimate of the password's entropy in bits. The password is
+// split into the cheapest sequence of segments, where a segment is either a single
+// brute forced character, a dictionary word, one of the user inputs (their name,
+// email, ...), a repeated character or a sequence such as "abcd" or "4321".
+func Entropy(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	lower := make([]rune, len(runes))
+	unleet := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+		unleet[i] = lower[i]
+		if sub, ok := leet[lower[i]]; ok {
+			unleet[i] = sub
+		}
+	}
+
+	inputs := make(map[string]bool)
+	for _, input := range userInputs {
+		for _, token := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(token)) >= 3 {
+				inputs[token] = true
+			}
+		}
+	}
+
+	bruteBits := math.Log2(float64(cardinality(runes)))
+
+	best := make([]float64, len(runes)+1)
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] + bruteBits
+		for j := 0; j <= i-3; j++ {
+			cost := best[j] + segmentBits(runes[j:i], lower[j:i], unleet[j:i], inputs, bruteBits)
+			if cost < best[i] {
+				best[i] = cost
+			}
+		}
+	}
+	return best[len(runes)]
+}
+
+func segmentBits(runes, lower, unleet []rune, inputs map[string]bool, bruteBits float64) float64 {
+	bits := math.Inf(1)
+	length := float64(len(runes))
+
+	word := string(lower)
+	if inputs[word] {
+		bits = math.Min(bits, 1+caseBits(runes))
+	}
+	if rank, ok := dictionary[word]; ok {
+		bits = math.Min(bits, math.Log2(float64(rank+1))+caseBits(runes))
+	}
+
+	if substituted := string(unleet); substituted != word {
+		if inputs[substituted] {
+			bits = math.Min(bits, 2+caseBits(runes))
+		}
+		if rank, ok := dictionary[substituted]; ok {
+			bits = math.Min(bits, math.Log2(float64(rank+1))+1+caseBits(runes))
+		}
+	}
+
+	if isRepeat(lower) {
+		bits = math.Min(bits, bruteBits+math.Log2(length))
+	}
+	if isSequence(lower) {
+		bits = math.Min(bits, bruteBits+math.Log2(length)+1)
+	}
+	return bits
+}
+
+// caseBits is the cost of guessing the capitalisation of a word, nothing for
+// lowercase, a bit for the common "Word" and "WORD" and one bit per uppercase
+// letter otherwise.
+func caseBits(runes []rune) float64 {
+	upper := 0
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 0
+	case upper == len(runes), upper == 1 && unicode.IsUpper(runes[0]):
+		return 1
+	default:
+		return float64(upper)
+	}
+}
+
+func isRepeat(runes []rune) bool {
+	for _, r := range runes[1:] {
+		if r != runes[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSequence(runes []rune) bool {
+	step := runes[1] - runes[0]
+	if step != 1 && step != -1 {
+		return false
+	}
+	for i := 2; i < len(runes); i++ {
+		if runes[i]-runes[i-1] != step {
+			return false
+		}
+	}
+	return true
+}
+
+// cardinality is the size of the alphabet an attacker would have to brute force,
+// based on the character classes present in the password.
+func cardinality(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
@@ -0,0 +1,57 @@
+package strength
+
+import "testing"
+
+func TestEntropy(t *testing.T) {
+	userInputs := []string{"Alice Smith", "alice@example.com"}
+
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		weak       bool
+	}{
+		{"empty", "", nil, true},
+		{"common password", "password", nil, true},
+		{"capitalised", "Password", nil, true},
+		{"leet substitutions", "P@ssw0rd", nil, true},
+		{"repeated character", "aaaaaaaaaaaa", nil, true},
+		{"letter sequence", "abcdefghijkl", nil, true},
+		{"descending digits", "987654321", nil, true},
+		{"keyboard row", "qwertyuiop", nil, true},
+		{"two dictionary words", "dragonmonkey", nil, true},
+		{"word and digits", "iloveyou123", nil, true},
+		{"name and year", "alice1990", userInputs, true},
+		{"email local part", "alice@example", userInputs, true},
+		{"name and year for someone else", "alice1990", nil, false},
+		{"random characters", "xK9#mQ2$vL7@pR4!", nil, false},
+		{"passphrase", "correct horse battery staple", nil, false},
+		{"mangled word", "Tr0ub4dor&3", userInputs, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits := Entropy(tt.password, tt.userInputs...)
+			if weak := bits < 40; weak != tt.weak {
+				t.Errorf("got %.1f bits; want weak %t", bits, tt.weak)
+			}
+		})
+	}
+}
+
+func TestEntropyOrdering(t *testing.T) {
+	tests := []struct {
+		weaker, stronger string
+	}{
+		{"password", "Password"},
+		{"Password", "P@ssw0rd"},
+		{"aaaaaaaa", "aaaaaaaaaaaaaaaa"},
+		{"xK9#mQ2$", "xK9#mQ2$vL7@pR4!"},
+	}
+
+	for _, tt := range tests {
+		if Entropy(tt.weaker) >= Entropy(tt.stronger) {
+			t.Errorf("%q (%.1f bits) should be weaker than %q (%.1f bits)", tt.weaker, Entropy(tt.weaker), tt.stronger, Entropy(tt.stronger))
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("tmdb: not found")
+	ErrUnauthorized = errors.New("tmdb: invalid api key")
+)
+
+// StatusError is returned for a response whose status the client has no error of
+// its own for.
+type StatusError struct {
+	Path   string
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("tmdb: GET %s returned %s", e.Path, e.Status)
+}
+
+const DefaultBaseURL = "https://api.themoviedb.org/3"
+
+type Genre struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Movie is the subset of the TMDB movie details the catalogue stores.
+type Movie struct {
+	ID          int64   `json:"id"`
+	Title       string  `json:"title"`
+	Overview    string  `json:"overview"`
+	ReleaseDate string  `json:"release_date"`
+	Runtime     int16   `json:"runtime"`
+	Popularity  float32 `json:"popularity"`
+	PosterPath  string  `json:"poster_path"`
+	Genres      []Genre `json:"genres"`
+}
+
+// Client talks to a TMDB compatible API. Requests are spaced out by a client side
+// limiter, and responses with status 429 are retried after the delay the server
+// asks for.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+	limiter *rate.Limiter
+	retries int
+}
+
+// NewClient creates a client for baseURL, e.g. DefaultBaseURL or the address of a
+// local fake server. apiKey is sent as a bearer token when it looks like a v4 read
+// access token and as the api_key parameter otherwise.
+func NewClient(baseURL, apiKey string, rps float64) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		limiter: rate.NewLimiter(rate.Limit(rps), 1),
+		retries: 3,
+	}
+}
+
+func (c *Client) Movie(ctx context.Context, id int64) (*Movie, error) {
+	var movie Movie
+	err := c.get(ctx, fmt.Sprintf("/movie/%d", id), nil, &movie)
+	if err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+type listItem struct {
+	ID        int64  `json:"id"`
+	MediaType string `json:"media_type"`
+}
+
+// page is a page of discover results or of list items, which TMDB returns under
+// different keys.
+type page struct {
+	Page       int        `json:"page"`
+	TotalPages int        `json:"total_pages"`
+	Results    []listItem `json:"results"`
+	Items      []listItem `json:"items"`
+}
+
+// ListIDs returns the ids of the movies on a TMDB list, up to limit of them.
+func (c *Client) ListIDs(ctx context.Context, listID string, limit int) ([]int64, error) {
+	return c.pagedIDs(ctx, "/list/"+url.PathEscape(listID), nil, limit)
+}
+
+// DiscoverIDs returns the ids of the movies released between from and to, most
+// popular first, up to limit of them.
+func (c *Client) DiscoverIDs(ctx context.Context, from, to time.Time, limit int) ([]int64, error) {
+	params := url.Values{}
+	params.Set("primary_release_date.gte", from.Format("2006-01-02"))
+	params.Set("primary_release_date.lte", to.Format("2006-01-02"))
+	params.Set("sort_by", "popularity.desc")
+	return c.pagedIDs(ctx, "/discover/movie", params, limit)
+}
+
+func (c *Client) pagedIDs(ctx context.Context, path string, params url.Values, limit int) ([]int64, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	ids := []int64{}
+	for n := 1; ; n++ {
+		params.Set("page", strconv.Itoa(n))
+
+		var p page
+		err := c.get(ctx, path, params, &p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range append(p.Results, p.Items...) {
+			if item.MediaType != "" && item.MediaType != "movie" {
+				continue
+			}
+			ids = append(ids, item.ID)
+			if len(ids) == limit {
+				return ids, nil
+			}
+		}
+
+		if n >= p.TotalPages || len(p.Results)+len(p.Items) == 0 {
+			return ids, nil
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, params url.Values, dst interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	if c.apiKey != "" && !strings.Contains(c.apiKey, ".") {
+		params.Set("api_key", c.apiKey)
+	}
+
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if strings.Contains(c.apiKey, ".") {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests && attempt < c.retries {
+			res.Body.Close()
+
+			err = sleep(ctx, retryAfter(res.Header.Get("Retry-After"), attempt))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = decode(res, dst)
+		res.Body.Close()
+		return err
+	}
+}
+
+func decode(res *http.Response, dst interface{}) error {
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case res.StatusCode != http.StatusOK:
+		return &StatusError{Path: res.Request.URL.Path, Status: res.Status}
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 10_485_760)).Decode(dst)
+}
+
+// retryAfter reads the delay from a Retry-After header in seconds, falling back to
+// an exponential backoff when the server does not send one.
+func retryAfter(header string, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(1<<attempt) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
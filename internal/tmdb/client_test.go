@@ -0,0 +1,232 @@
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, apiKey string, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", apiKey, 1000)
+}
+
+func TestMovie(t *testing.T) {
+	var calls int32
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		wantErr   bool
+		wantIs    error
+		wantCalls int32
+	}{
+		{
+			name: "ok",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(Movie{ID: 603, Title: "The Matrix"})
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "retried after 429",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&calls) < 3 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				json.NewEncoder(w).Encode(Movie{ID: 603, Title: "The Matrix"})
+			},
+			wantCalls: 3,
+		},
+		{
+			name: "429 past the retries",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			wantErr:   true,
+			wantCalls: 4,
+		},
+		{
+			name: "unauthorized",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantErr:   true,
+			wantIs:    ErrUnauthorized,
+			wantCalls: 1,
+		},
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr:   true,
+			wantIs:    ErrNotFound,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			c := newTestClient(t, "key", func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				if r.URL.Path != "/movie/603" {
+					t.Errorf("got path %q; want /movie/603", r.URL.Path)
+				}
+				tt.handler(w, r)
+			})
+
+			movie, err := c.Movie(context.Background(), 603)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("got error %v; want %v", err, tt.wantIs)
+			}
+			if !tt.wantErr && movie.Title != "The Matrix" {
+				t.Errorf("got movie %+v", movie)
+			}
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("got %d requests; want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantParam  string
+		wantHeader string
+	}{
+		{"v3 api key", "abc123", "abc123", ""},
+		{"v4 read access token", "eyJ.payload.signature", "", "Bearer eyJ.payload.signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.apiKey, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("api_key"); got != tt.wantParam {
+					t.Errorf("got api_key %q; want %q", got, tt.wantParam)
+				}
+				if got := r.Header.Get("Authorization"); got != tt.wantHeader {
+					t.Errorf("got Authorization %q; want %q", got, tt.wantHeader)
+				}
+				json.NewEncoder(w).Encode(Movie{ID: 1})
+			})
+
+			_, err := c.Movie(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// listHandler serves a TMDB list of three pages, the second of which includes a
+// tv show, and records the pages requested.
+func listHandler(t *testing.T, requested *[]int) http.HandlerFunc {
+	pages := map[int][]listItem{
+		1: {{ID: 1, MediaType: "movie"}, {ID: 2, MediaType: "movie"}},
+		2: {{ID: 3, MediaType: "tv"}, {ID: 4, MediaType: "movie"}},
+		3: {{ID: 5, MediaType: "movie"}},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			t.Errorf("got page %q", r.URL.Query().Get("page"))
+		}
+		*requested = append(*requested, n)
+		json.NewEncoder(w).Encode(page{Page: n, TotalPages: len(pages), Items: pages[n]})
+	}
+}
+
+func TestListIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		wantIDs   []int64
+		wantPages []int
+	}{
+		{"every page", 100, []int64{1, 2, 4, 5}, []int{1, 2, 3}},
+		{"limit within the first page", 1, []int64{1}, []int{1}},
+		{"limit on a later page", 3, []int64{1, 2, 4}, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []int
+			c := newTestClient(t, "key", listHandler(t, &requested))
+
+			ids, err := c.ListIDs(context.Background(), "42", tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("got ids %v; want %v", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(requested, tt.wantPages) {
+				t.Errorf("got pages %v; want %v", requested, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestDiscoverIDs(t *testing.T) {
+	c := newTestClient(t, "key", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/discover/movie" || q.Get("primary_release_date.gte") != "2020-01-01" || q.Get("primary_release_date.lte") != "2020-12-31" {
+			t.Errorf("got %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(page{Page: 1, TotalPages: 1, Results: []listItem{{ID: 7}, {ID: 8}}})
+	})
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	ids, err := c.DiscoverIDs(context.Background(), from, to, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{7, 8}) {
+		t.Errorf("got ids %v; want [7 8]", ids)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header  string
+		attempt int
+		want    time.Duration
+	}{
+		{"0", 0, 0},
+		{"5", 2, 5 * time.Second},
+		{"", 0, time.Second},
+		{"", 2, 4 * time.Second},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 1, 2 * time.Second},
+		{"-1", 0, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := retryAfter(tt.header, tt.attempt); got != tt.want {
+			t.Errorf("retryAfter(%q, %d): got %v; want %v", tt.header, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"github.com/DARKestMODE/movify/internal/data"
+	"github.com/DARKestMODE/movify/internal/validator"
+)
+
+type Result struct {
+	IdTMDB  int64             `json:"id_tmdb"`
+	Status  string            `json:"status"`
+	MovieID int64             `json:"movie_id,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type Report struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Failed  int      `json:"failed"`
+	Results []Result `json:"results"`
+}
+
+// Importer copies movies from TMDB into the catalogue, keyed on their TMDB id.
+type Importer struct {
+	Client *Client
+	Movies data.MovieModel
+}
+
+// Import fetches and upserts every movie in ids. Movies that are missing upstream,
+// come back with an unexpected status or fail validation are reported as failed
+// and do not stop the import. Anything else, such as an invalid api key, an
+// unreachable server, a cancelled context or a database error, would fail the
+// remaining movies just the same, so it stops the import and is returned along
+// with the report of the movies imported until then.
+func (i *Importer) Import(ctx context.Context, ids []int64) (*Report, error) {
+	report := &Report{Results: []Result{}}
+
+	for _, id := range ids {
+		result := Result{IdTMDB: id, Status: "failed"}
+
+		movie, err := i.Client.Movie(ctx, id)
+		var statusErr *StatusError
+		switch {
+		case err == nil:
+			result, err = i.upsert(movie)
+			if err != nil {
+				return report, err
+			}
+		case errors.Is(err, ErrNotFound), errors.As(err, &statusErr):
+			result.Error = err.Error()
+		default:
+			return report, err
+		}
+
+		switch result.Status {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		default:
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+func (i *Importer) upsert(movie *Movie) (Result, error) {
+	mv := &data.Movie{
+		IdTMDB:      movie.ID,
+		Title:       movie.Title,
+		Overview:    movie.Overview,
+		ReleaseDate: movie.ReleaseDate,
+		Runtime:     movie.Runtime,
+		Popularity:  movie.Popularity,
+		PosterPath:  movie.PosterPath,
+		Genres:      []string{},
+	}
+	for _, genre := range movie.Genres {
+		// TMDB lists the most relevant genres first, the catalogue keeps up to 5
+		if len(mv.Genres) < 5 {
+			mv.Genres = append(mv.Genres, genre.Name)
+		}
+	}
+
+	result := Result{IdTMDB: movie.ID, Status: "failed"}
+
+	v := validator.New()
+	if data.ValidateMovie(v, mv); !v.Valid() {
+		result.Errors = v.Errors
+		return result, nil
+	}
+
+	inserted, err := i.Movies.Upsert(mv)
+	if err != nil {
+		return result, err
+	}
+
+	result.MovieID = mv.Id
+	result.Status = "updated"
+	if inserted {
+		result.Status = "created"
+	}
+	return result, nil
+}
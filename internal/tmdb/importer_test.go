@@ -0,0 +1,62 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// The movies in these cases never reach the database, so the importer runs
+// without one.
+func TestImportFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		closed     bool
+		wantErr    bool
+		wantIs     error
+		wantFailed int
+		wantCalls  int32
+	}{
+		{name: "missing movies", status: http.StatusNotFound, wantFailed: 3, wantCalls: 3},
+		{name: "server errors", status: http.StatusBadGateway, wantFailed: 3, wantCalls: 3},
+		{name: "invalid api key", status: http.StatusUnauthorized, wantErr: true, wantIs: ErrUnauthorized, wantCalls: 1},
+		{name: "unreachable server", closed: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.status)
+			}))
+			if tt.closed {
+				server.Close()
+			} else {
+				t.Cleanup(server.Close)
+			}
+
+			importer := &Importer{Client: NewClient(server.URL, "key", 1000)}
+			report, err := importer.Import(context.Background(), []int64{1, 2, 3})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("got error %v; want %v", err, tt.wantIs)
+			}
+			if report == nil {
+				t.Fatal("got no report")
+			}
+			if report.Failed != tt.wantFailed || len(report.Results) != tt.wantFailed {
+				t.Errorf("got %d failed of %d results; want %d", report.Failed, len(report.Results), tt.wantFailed)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("got %d requests; want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
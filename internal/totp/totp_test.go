@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rfcSecret = []byte("12345678901234567890")
+
+// The SHA1 vectors of RFC 6238, appendix B, cut down to six digits.
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(rfcSecret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("Code at %d: got %q; want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", Code(rfcSecret, current), 0, current, true},
+		{"previous step", Code(rfcSecret, current-1), 0, current - 1, true},
+		{"next step", Code(rfcSecret, current+1), 0, current + 1, true},
+		{"outside the window", Code(rfcSecret, current-2), 0, 0, false},
+		{"replayed", Code(rfcSecret, current), current, 0, false},
+		{"older than the last step", Code(rfcSecret, current-1), current - 1, 0, false},
+		{"after an older step", Code(rfcSecret, current), current - 1, current, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"wrong length", Code(rfcSecret, current)[:5], 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("got (%d, %t); want (%d, %t)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Movify", "alice@example.com", rfcSecret)
+
+	for _, want := range []string{"otpauth://totp/Movify:alice@example.com?", "secret=" + EncodeSecret(rfcSecret), "issuer=Movify", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("%q does not contain %q", uri, want)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	sealed, err := Seal(key, rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := Open(key, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, rfcSecret) {
+		t.Errorf("got %q; want %q", opened, rfcSecret)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+	}{
+		{"wrong key", bytes.Repeat([]byte{8}, 32), sealed},
+		{"short key", key[:16], sealed},
+		{"tampered", key, append(append([]byte{}, sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1)},
+		{"truncated", key, sealed[:4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(tt.key, tt.sealed)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS invites
+(
+    id          bigserial PRIMARY KEY,
+    hash        bytea UNIQUE                NOT NULL,
+    email       citext                      NOT NULL,
+    permissions text[]                      NOT NULL DEFAULT '{}',
+    created_by  bigint                      REFERENCES users ON DELETE SET NULL,
+    expiry      timestamp(0) with time zone NOT NULL,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    used_at     timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS invites_email_idx ON invites (email);
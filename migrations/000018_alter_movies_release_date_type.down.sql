@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS movies_release_date_idx;
+ALTER TABLE movies ALTER COLUMN release_date TYPE text USING to_char(release_date, 'YYYY-MM-DD');
+
+-- movies which have since been given a real release date keep it
+UPDATE movies m
+SET release_date = i.release_date,
+    version      = m.version + 1
+FROM movies_invalid_release_dates i
+WHERE m.id = i.movie_id
+  AND m.release_date = '1888-01-01';
+
+DROP TABLE IF EXISTS movies_invalid_release_dates;
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- Release dates were free text until now. The ones that aren't a valid YYYY-MM-DD
+-- date can't be cast, so they are set to 1888-01-01, the earliest date the API
+-- accepts, and the original text is kept in movies_invalid_release_dates for the
+-- down migration to put back.
+CREATE FUNCTION pg_temp.is_date(s text) RETURNS boolean AS
+$$
+BEGIN
+    IF s !~ '^\d{4}-\d{2}-\d{2}$' THEN
+        RETURN false;
+    END IF;
+    PERFORM s::date;
+    RETURN true;
+EXCEPTION
+    WHEN others THEN
+        RETURN false;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TABLE IF NOT EXISTS movies_invalid_release_dates
+(
+    movie_id     bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    release_date text NOT NULL
+);
+
+INSERT INTO movies_invalid_release_dates (movie_id, release_date)
+SELECT id, release_date
+FROM movies
+WHERE NOT pg_temp.is_date(release_date);
+
+UPDATE movies
+SET release_date = '1888-01-01',
+    version      = version + 1
+WHERE id IN (SELECT movie_id FROM movies_invalid_release_dates);
+
+ALTER TABLE movies ALTER COLUMN release_date TYPE date USING release_date::date;
+
+CREATE INDEX IF NOT EXISTS movies_release_date_idx ON movies (release_date);
@@ -0,0 +1 @@
+ALTER TABLE token_denylist ALTER COLUMN revoked_at TYPE timestamp(6) with time zone;
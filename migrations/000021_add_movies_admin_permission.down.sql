@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
\ No newline at end of file
@@ -0,0 +1,9 @@
+INSERT INTO permissions (code)
+VALUES ('movies:admin');
+
+INSERT INTO roles_permissions
+SELECT r.id, p.id
+FROM roles r,
+     permissions p
+WHERE r.name = 'admin'
+  AND p.code = 'movies:admin';
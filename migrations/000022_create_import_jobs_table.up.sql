@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS import_jobs
+(
+    id          bigserial PRIMARY KEY,
+    source      text                        NOT NULL,
+    status      text                        NOT NULL,
+    report      jsonb,
+    error       text,
+    created_by  bigint                      REFERENCES users ON DELETE SET NULL,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone
+);
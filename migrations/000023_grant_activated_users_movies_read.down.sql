@@ -0,0 +1,2 @@
+-- the backfilled grants can't be told apart from later ones, so they are kept
+SELECT 1;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- Activation didn't grant any permissions before, so users activated until now
+-- are given movies:read, the default of -permissions-activation. Deployments that
+-- configure other activation permissions have to grant them to these users
+-- themselves, e.g. through POST /v1/admin/users/:id/permissions.
+INSERT INTO users_permissions
+SELECT u.id, p.id
+FROM users u,
+     permissions p
+WHERE u.activated
+  AND p.code = 'movies:read'
+ON CONFLICT DO NOTHING;